@@ -3,12 +3,13 @@ package admin
 import (
 	"bufio"
 	"context"
+	"encoding/json"
 	"fmt"
 	"golang.org/x/oauth2"
 	"google.golang.org/api/admin/directory/v1"
 	"google.golang.org/api/option"
-	"log"
 	"os"
+	"sort"
 	"strings"
 )
 
@@ -23,54 +24,292 @@ func InitService(ts oauth2.TokenSource) {
 	}
 }
 
-func ListGroups(domain string) {
-	list, err := service.Groups.List().Domain(domain).Do()
+type groupInfo struct {
+	Id                 string   `json:"id"`
+	Email              string   `json:"email"`
+	Name               string   `json:"name"`
+	Description        string   `json:"description,omitempty"`
+	DirectMembersCount int64    `json:"directMembersCount"`
+	Aliases            []string `json:"aliases,omitempty"`
+	NonEditableAliases []string `json:"nonEditableAliases,omitempty"`
+}
+
+func toGroupInfo(g *admin.Group) *groupInfo {
+	return &groupInfo{
+		Id:                 g.Id,
+		Email:              g.Email,
+		Name:               g.Name,
+		Description:        g.Description,
+		DirectMembersCount: g.DirectMembersCount,
+		Aliases:            g.Aliases,
+		NonEditableAliases: g.NonEditableAliases,
+	}
+}
+
+// ListGroups lists all groups of the domain, or of the whole customer when domain is empty.
+func ListGroups(domain string, jsonOut bool) error {
+	call := service.Groups.List().MaxResults(200)
+	if domain != "" {
+		call.Domain(domain)
+	} else {
+		call.Customer("my_customer")
+	}
+	var groups []*groupInfo
+	err := call.Pages(context.Background(), func(list *admin.Groups) error {
+		for _, g := range list.Groups {
+			groups = append(groups, toGroupInfo(g))
+		}
+		return nil
+	})
 	if err != nil {
-		log.Fatalln(err)
+		return err
+	}
+	if jsonOut {
+		return printJSON(groups)
 	}
-	for i, group := range list.Groups {
-		fmt.Println(i, group.Id, group.Email)
+	for i, g := range groups {
+		fmt.Printf("%d id: %s email: %s name: %s members: %d\n", i, g.Id, g.Email, g.Name, g.DirectMembersCount)
 	}
+	return nil
 }
 
-func CreateGroup(email string) {
+func CreateGroup(email, name, description string) error {
 	group := &admin.Group{
 		AdminCreated: false,
 		Email:        email,
+		Name:         name,
+		Description:  description,
 	}
-	_, err := service.Groups.Insert(group).Do()
+	g, err := service.Groups.Insert(group).Do()
 	if err != nil {
-		fmt.Println(err)
+		return err
 	}
+	fmt.Printf("Create group id: %s email: %s [OK]\n", g.Id, g.Email)
+	return nil
 }
 
-func AddGroupMember(group string, user string, filepath string) {
-	if user != "" {
-		doAddGroupMember(group, user)
+func DeleteGroup(emails []string) {
+	for i, email := range emails {
+		if err := service.Groups.Delete(email).Do(); err != nil {
+			fmt.Println(err)
+		} else {
+			fmt.Printf("%d Delete group: %s [OK]\n", i, email)
+		}
+	}
+}
+
+func GroupInfo(email string, jsonOut bool) error {
+	g, err := service.Groups.Get(email).Do()
+	if err != nil {
+		return err
+	}
+	info := toGroupInfo(g)
+	if jsonOut {
+		return printJSON(info)
+	}
+	fmt.Println("id:", info.Id)
+	fmt.Println("email:", info.Email)
+	fmt.Println("name:", info.Name)
+	fmt.Println("description:", info.Description)
+	fmt.Println("members:", info.DirectMembersCount)
+	fmt.Println("aliases:", strings.Join(append(info.Aliases, info.NonEditableAliases...), ", "))
+	return nil
+}
+
+// UpdateGroup patches the non-empty fields of the group.
+func UpdateGroup(email, newEmail, name, description string) error {
+	group := &admin.Group{
+		Email:       newEmail,
+		Name:        name,
+		Description: description,
+	}
+	g, err := service.Groups.Patch(email, group).Do()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Update group id: %s email: %s [OK]\n", g.Id, g.Email)
+	return nil
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+type memberInfo struct {
+	Id     string `json:"id"`
+	Email  string `json:"email"`
+	Role   string `json:"role"`
+	Type   string `json:"type"`
+	Status string `json:"status,omitempty"`
+}
+
+// ListMembers returns the members of the group, roles is a comma separated list of OWNER, MANAGER, MEMBER.
+func ListMembers(group string, roles string) ([]*admin.Member, error) {
+	call := service.Members.List(group).MaxResults(200)
+	if roles != "" {
+		call.Roles(strings.ToUpper(roles))
+	}
+	var members []*admin.Member
+	err := call.Pages(context.Background(), func(list *admin.Members) error {
+		members = append(members, list.Members...)
+		return nil
+	})
+	return members, err
+}
+
+// ListGroupMembers prints the members of the group, memberType filters on USER, GROUP, CUSTOMER or EXTERNAL.
+func ListGroupMembers(group, roles, memberType string, jsonOut bool) error {
+	members, err := ListMembers(group, roles)
+	if err != nil {
+		return err
+	}
+	var infos []*memberInfo
+	for _, m := range members {
+		if memberType != "" && !strings.EqualFold(m.Type, memberType) {
+			continue
+		}
+		infos = append(infos, &memberInfo{Id: m.Id, Email: m.Email, Role: m.Role, Type: m.Type, Status: m.Status})
+	}
+	if jsonOut {
+		return printJSON(infos)
+	}
+	for i, m := range infos {
+		fmt.Printf("%d email: %s role: %s type: %s\n", i, m.Email, m.Role, m.Type)
+	}
+	return nil
+}
+
+// AddGroupMember adds a user, group or service account, or every email in the file, with the role.
+func AddGroupMember(group string, user string, filepath string, role string, concurrency int, qps float64) {
+	users, err := members(user, filepath)
+	if err != nil {
+		fmt.Println(err)
 		return
 	}
-	file, err := os.Open(filepath)
+	AddGroupMembers(group, users, role, concurrency, qps)
+}
+
+func RemoveGroupMember(group string, user string, filepath string) {
+	users, err := members(user, filepath)
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
+	for _, user := range users {
+		if err = service.Members.Delete(group, user).Do(); err != nil {
+			fmt.Println(err)
+		} else {
+			fmt.Printf("Remove user: %s [OK]\n", user)
+		}
+	}
+}
+
+func SetGroupMemberRole(group string, user string, role string) error {
+	role = strings.ToUpper(role)
+	switch role {
+	case "OWNER", "MANAGER", "MEMBER":
+	default:
+		return fmt.Errorf("invalid role: %s, must be OWNER, MANAGER or MEMBER", role)
+	}
+	if _, err := service.Members.Patch(group, user, &admin.Member{Role: role}).Fields().Do(); err != nil {
+		return err
+	}
+	fmt.Printf("Set user: %s role: %s [OK]\n", user, role)
+	return nil
+}
+
+// members returns the single user, or the emails read from the file one per line.
+func members(user string, filepath string) ([]string, error) {
+	if user != "" {
+		return []string{user}, nil
+	}
+	file, err := os.Open(filepath)
+	if err != nil {
+		return nil, err
+	}
 	defer file.Close()
+	var users []string
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
 		user = strings.TrimSpace(scanner.Text())
 		if user == "" {
 			continue
 		}
-		doAddGroupMember(group, user)
+		users = append(users, user)
 	}
+	return users, scanner.Err()
 }
 
-func doAddGroupMember(group string, user string) error {
-	_, err := service.Members.Insert(group, &admin.Member{Email: user}).Fields().Do()
+// SyncGroupMembers makes the group members match the emails file, extras are only removed with prune.
+// Owners are never pruned.
+func SyncGroupMembers(group string, filepath string, prune bool, dryRun bool, concurrency int, qps float64) error {
+	desired, err := members("", filepath)
 	if err != nil {
-		fmt.Println(err)
-	} else {
-		fmt.Printf("Add user: %s [OK]\n", user)
+		return err
+	}
+	current, err := ListMembers(group, "")
+	if err != nil {
+		return err
 	}
-	return err
+	existing := make(map[string]*admin.Member)
+	for _, m := range current {
+		if m.Email != "" {
+			existing[strings.ToLower(m.Email)] = m
+		}
+	}
+	wanted := make(map[string]bool)
+	var adds, removes []string
+	for _, email := range desired {
+		email = strings.ToLower(email)
+		if wanted[email] {
+			continue
+		}
+		wanted[email] = true
+		if _, ok := existing[email]; !ok {
+			adds = append(adds, email)
+		}
+	}
+	kept := 0
+	for email, m := range existing {
+		if wanted[email] {
+			continue
+		}
+		if !prune || m.Role == "OWNER" {
+			kept++
+			continue
+		}
+		removes = append(removes, email)
+	}
+	sort.Strings(removes)
+
+	fmt.Printf("Plan for group: %s\n", group)
+	for _, email := range adds {
+		fmt.Println("+", email)
+	}
+	for _, email := range removes {
+		fmt.Println("-", email)
+	}
+	fmt.Printf("add: %d remove: %d unchanged: %d extra kept: %d\n", len(adds), len(removes), len(wanted)-len(adds), kept)
+	if dryRun || len(adds)+len(removes) == 0 {
+		return nil
+	}
+
+	if len(adds) > 0 {
+		bulkAddMembers(group, adds, "", concurrency, qps).print()
+	}
+	for _, email := range removes {
+		if err = service.Members.Delete(group, email).Do(); err != nil {
+			fmt.Println(err)
+		} else {
+			fmt.Printf("Remove user: %s [OK]\n", email)
+		}
+	}
+	return nil
+}
+
+// AddGroupMembers adds the emails to the group in bulk and prints a summary.
+func AddGroupMembers(group string, emails []string, role string, concurrency int, qps float64) {
+	bulkAddMembers(group, emails, strings.ToUpper(role), concurrency, qps).print()
 }
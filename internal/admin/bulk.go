@@ -0,0 +1,126 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"google.golang.org/api/admin/directory/v1"
+	"google.golang.org/api/googleapi"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const maxRetries = 5
+
+type memberJob struct {
+	email    string
+	attempts int
+}
+
+type bulkResult struct {
+	mu      sync.Mutex
+	added   []string
+	skipped []string
+	failed  map[string]error
+}
+
+// bulkAddMembers inserts the members with bounded concurrency, at most qps requests per second.
+// Already existing members are skipped, rate limit and server errors are retried with backoff.
+func bulkAddMembers(group string, emails []string, role string, concurrency int, qps float64) *bulkResult {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if qps <= 0 {
+		qps = 10
+	}
+	limiter := time.NewTicker(time.Duration(float64(time.Second) / qps))
+	defer limiter.Stop()
+
+	result := &bulkResult{failed: make(map[string]error)}
+	jobs := make(chan *memberJob, len(emails))
+	var pending sync.WaitGroup
+	pending.Add(len(emails))
+	for _, email := range emails {
+		jobs <- &memberJob{email: email}
+	}
+
+	var workers sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for job := range jobs {
+				<-limiter.C
+				job.attempts++
+				_, err := service.Members.Insert(group, &admin.Member{Email: job.email, Role: role}).Fields().Do()
+				switch {
+				case err == nil:
+					result.add(&result.added, job.email)
+					fmt.Printf("Add user: %s [OK]\n", job.email)
+				case isConflict(err):
+					result.add(&result.skipped, job.email)
+					fmt.Printf("Add user: %s [EXISTS]\n", job.email)
+				case isRetryable(err) && job.attempts < maxRetries:
+					backoff := time.Duration(1<<job.attempts) * time.Second
+					fmt.Printf("Add user: %s retry in %s: %v\n", job.email, backoff, err)
+					job := job
+					time.AfterFunc(backoff, func() { jobs <- job })
+					continue
+				default:
+					result.mu.Lock()
+					result.failed[job.email] = err
+					result.mu.Unlock()
+					fmt.Printf("Add user: %s [ERROR] %v\n", job.email, err)
+				}
+				pending.Done()
+			}
+		}()
+	}
+	pending.Wait()
+	close(jobs)
+	workers.Wait()
+	return result
+}
+
+func (r *bulkResult) add(list *[]string, email string) {
+	r.mu.Lock()
+	*list = append(*list, email)
+	r.mu.Unlock()
+}
+
+func (r *bulkResult) print() {
+	fmt.Printf("added: %d skipped: %d failed: %d\n", len(r.added), len(r.skipped), len(r.failed))
+	var failed []string
+	for email := range r.failed {
+		failed = append(failed, email)
+	}
+	sort.Strings(failed)
+	for _, email := range failed {
+		fmt.Printf("failed: %s %v\n", email, r.failed[email])
+	}
+}
+
+func isConflict(err error) bool {
+	var gerr *googleapi.Error
+	return errors.As(err, &gerr) && gerr.Code == http.StatusConflict
+}
+
+func isRetryable(err error) bool {
+	var gerr *googleapi.Error
+	if !errors.As(err, &gerr) {
+		return true
+	}
+	if gerr.Code == http.StatusTooManyRequests || gerr.Code >= 500 {
+		return true
+	}
+	if gerr.Code == http.StatusForbidden {
+		for _, e := range gerr.Errors {
+			switch e.Reason {
+			case "rateLimitExceeded", "userRateLimitExceeded", "quotaExceeded":
+				return true
+			}
+		}
+	}
+	return false
+}
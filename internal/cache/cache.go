@@ -0,0 +1,156 @@
+package cache
+
+import (
+	"container/list"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Cache is an on-disk block cache with LRU eviction.
+// Each block is stored as a single file named by key and block index.
+type Cache struct {
+	dir       string
+	blockSize int64
+	maxSize   int64
+
+	mu    sync.Mutex
+	size  int64
+	lru   *list.List
+	items map[string]*list.Element
+}
+
+const tmpPrefix = ".tmp-"
+
+type entry struct {
+	name string
+	size int64
+}
+
+func New(dir string, blockSize, maxSize int64) (*Cache, error) {
+	if blockSize <= 0 {
+		return nil, fmt.Errorf("invalid cache block size: %d", blockSize)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	c := &Cache{
+		dir:       dir,
+		blockSize: blockSize,
+		maxSize:   maxSize,
+		lru:       list.New(),
+		items:     make(map[string]*list.Element),
+	}
+	fs, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	// oldest first, so the most recently written blocks end up at the front
+	sort.Slice(fs, func(i, j int) bool {
+		return fs[i].ModTime().Before(fs[j].ModTime())
+	})
+	for _, f := range fs {
+		if f.IsDir() {
+			continue
+		}
+		// left over by a Put interrupted before its rename
+		if strings.HasPrefix(f.Name(), tmpPrefix) {
+			os.Remove(filepath.Join(dir, f.Name()))
+			continue
+		}
+		c.items[f.Name()] = c.lru.PushFront(&entry{name: f.Name(), size: f.Size()})
+		c.size += f.Size()
+	}
+	c.mu.Lock()
+	c.evict()
+	c.mu.Unlock()
+	return c, nil
+}
+
+func (c *Cache) BlockSize() int64 {
+	return c.blockSize
+}
+
+// Get returns the cached block of key, key should identify the content (e.g. fileId+md5).
+func (c *Cache) Get(key string, block int64) ([]byte, bool) {
+	name := blockName(key, block)
+	c.mu.Lock()
+	e, ok := c.items[name]
+	if ok {
+		c.lru.MoveToFront(e)
+	}
+	c.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	b, err := ioutil.ReadFile(filepath.Join(c.dir, name))
+	if err != nil {
+		c.remove(name)
+		return nil, false
+	}
+	return b, true
+}
+
+func (c *Cache) Put(key string, block int64, data []byte) error {
+	name := blockName(key, block)
+	tmp, err := ioutil.TempFile(c.dir, tmpPrefix)
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(c.dir, name))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[name]; ok {
+		c.size -= e.Value.(*entry).size
+		c.lru.Remove(e)
+	}
+	c.items[name] = c.lru.PushFront(&entry{name: name, size: int64(len(data))})
+	c.size += int64(len(data))
+	c.evict()
+	return nil
+}
+
+func (c *Cache) remove(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[name]; ok {
+		c.size -= e.Value.(*entry).size
+		c.lru.Remove(e)
+		delete(c.items, name)
+	}
+	os.Remove(filepath.Join(c.dir, name))
+}
+
+// evict drops the least recently used blocks until the cache fits maxSize, must hold mu.
+func (c *Cache) evict() {
+	for c.maxSize > 0 && c.size > c.maxSize {
+		e := c.lru.Back()
+		if e == nil {
+			return
+		}
+		v := e.Value.(*entry)
+		c.lru.Remove(e)
+		delete(c.items, v.name)
+		c.size -= v.size
+		os.Remove(filepath.Join(c.dir, v.name))
+	}
+}
+
+func blockName(key string, block int64) string {
+	return fmt.Sprintf("%s.%d", key, block)
+}
@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPutGet(t *testing.T) {
+	c, err := New(t.TempDir(), 4, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Get("f-md5", 0); ok {
+		t.Fatal("empty cache returned a block")
+	}
+	if err = c.Put("f-md5", 0, []byte("abcd")); err != nil {
+		t.Fatal(err)
+	}
+	b, ok := c.Get("f-md5", 0)
+	if !ok || string(b) != "abcd" {
+		t.Fatalf("Get = %q %v, want abcd", b, ok)
+	}
+	if _, ok = c.Get("f-md5", 1); ok {
+		t.Fatal("other block of the same key returned")
+	}
+	if _, ok = c.Get("f-other", 0); ok {
+		t.Fatal("block of another key returned")
+	}
+}
+
+func TestEviction(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxSize int64
+		puts    []int64
+		gets    []int64
+		want    []int64
+		size    int64
+	}{
+		{name: "fits", maxSize: 12, puts: []int64{0, 1, 2}, want: []int64{0, 1, 2}, size: 12},
+		{name: "oldest evicted", maxSize: 8, puts: []int64{0, 1, 2}, want: []int64{1, 2}, size: 8},
+		{name: "get refreshes", maxSize: 8, puts: []int64{0, 1}, gets: []int64{0}, want: []int64{0}, size: 8},
+		{name: "put again does not double count", maxSize: 8, puts: []int64{0, 0, 0}, want: []int64{0}, size: 4},
+		{name: "unlimited", maxSize: 0, puts: []int64{0, 1, 2, 3}, want: []int64{0, 1, 2, 3}, size: 16},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(t.TempDir(), 4, tt.maxSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, i := range tt.puts {
+				if err = c.Put("k", i, []byte("1234")); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, i := range tt.gets {
+				c.Get("k", i)
+			}
+			if tt.gets != nil {
+				// the refreshed block must survive the next put
+				if err = c.Put("k", 9, []byte("1234")); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, i := range tt.want {
+				if _, ok := c.Get("k", i); !ok {
+					t.Errorf("block %d evicted", i)
+				}
+			}
+			if c.size != tt.size {
+				t.Errorf("size = %d, want %d", c.size, tt.size)
+			}
+		})
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	c, err := New(dir, 4, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(0); i < 3; i++ {
+		if err = c.Put("k", i, bytes.Repeat([]byte{'x'}, 4)); err != nil {
+			t.Fatal(err)
+		}
+		// oldest first by mtime on reload
+		mt := time.Now().Add(time.Duration(i-3) * time.Minute)
+		if err = os.Chtimes(filepath.Join(dir, blockName("k", i)), mt, mt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, tmpPrefix+"123"), []byte("partial"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err = New(dir, 4, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.size != 8 {
+		t.Errorf("size = %d, want 8", c.size)
+	}
+	if _, ok := c.Get("k", 0); ok {
+		t.Error("oldest block kept over the limit")
+	}
+	for _, i := range []int64{1, 2} {
+		if _, ok := c.Get("k", i); !ok {
+			t.Errorf("block %d lost on reload", i)
+		}
+	}
+	if _, err = os.Stat(filepath.Join(dir, tmpPrefix+"123")); !os.IsNotExist(err) {
+		t.Error("leftover tmp file not removed")
+	}
+}
+
+func TestNewInvalidBlockSize(t *testing.T) {
+	if _, err := New(t.TempDir(), 0, 0); err == nil {
+		t.Fatal("expected an error for a zero block size")
+	}
+}
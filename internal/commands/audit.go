@@ -0,0 +1,79 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/lnzx/gdc/internal/admin"
+	"github.com/lnzx/gdc/internal/drive"
+	"github.com/urfave/cli/v2"
+	"os"
+	"strings"
+)
+
+var Audit []*cli.Command
+
+func init() {
+	Audit = []*cli.Command{
+		{
+			Name:  "audit",
+			Usage: "audit reports",
+			Subcommands: []*cli.Command{
+				{
+					Name:  "perms",
+					Usage: "Permission report across all shared drives",
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:    "format",
+							Aliases: []string{"f"},
+							Usage:   "csv or json",
+							Value:   "csv",
+						},
+						&cli.StringFlag{
+							Name:    "output",
+							Aliases: []string{"o"},
+							Usage:   "report file, default stdout",
+						},
+						&cli.StringSliceFlag{
+							Name:  "internal-domain",
+							Usage: "domains not flagged as external, default the --subject domain",
+						},
+						&cli.StringFlag{
+							Name:  "allow-group",
+							Usage: "flag members not in the group (requires --subject)",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						subject := c.String("subject")
+						domains := c.StringSlice("internal-domain")
+						if i := strings.LastIndex(subject, "@"); len(domains) == 0 && i != -1 {
+							domains = []string{subject[i+1:]}
+						}
+						var allowed map[string]bool
+						if group := c.String("allow-group"); group != "" {
+							if subject == "" {
+								return fmt.Errorf("--allow-group requires --subject")
+							}
+							members, err := admin.ListMembers(group, "")
+							if err != nil {
+								return err
+							}
+							allowed = map[string]bool{strings.ToLower(group): true}
+							for _, m := range members {
+								allowed[strings.ToLower(m.Email)] = true
+							}
+						}
+						w := os.Stdout
+						if output := c.String("output"); output != "" {
+							f, err := os.Create(output)
+							if err != nil {
+								return err
+							}
+							defer f.Close()
+							w = f
+						}
+						return drive.AuditPermissions(w, c.String("format"), subject != "", domains, allowed)
+					},
+				},
+			},
+		},
+	}
+}
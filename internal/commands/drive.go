@@ -10,6 +10,96 @@ import (
 
 var Drive []*cli.Command
 
+var shareFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:    "role",
+		Aliases: []string{"r"},
+		Usage:   "organizer, fileOrganizer, writer, commenter or reader",
+		Value:   "organizer",
+	},
+	&cli.BoolFlag{
+		Name:  "notify",
+		Usage: "send notification email to users and groups",
+		Value: true,
+	},
+	&cli.StringFlag{
+		Name:    "message",
+		Aliases: []string{"m"},
+		Usage:   "notification email message",
+	},
+}
+
+// linkRoleFlag is the role of domain and anyone shares, which never get to manage the drive.
+var linkRoleFlag = &cli.StringFlag{
+	Name:    "role",
+	Aliases: []string{"r"},
+	Usage:   "writer, commenter or reader",
+	Value:   "reader",
+}
+
+func share(c *cli.Context) drive.Share {
+	return drive.Share{
+		Role:    c.String("role"),
+		Notify:  c.Bool("notify"),
+		Message: c.String("message"),
+	}
+}
+
+// boolFlag returns nil when the flag is not set, so --flag=false can be told from no flag.
+func boolFlag(c *cli.Context, name string) *bool {
+	if !c.IsSet(name) {
+		return nil
+	}
+	v := c.Bool(name)
+	return &v
+}
+
+var recursiveFlags = []cli.Flag{
+	&cli.BoolFlag{
+		Name:    "recursive",
+		Aliases: []string{"r"},
+		Usage:   "copy directories recursively",
+	},
+	&cli.IntFlag{
+		Name:    "concurrency",
+		Aliases: []string{"j"},
+		Usage:   "concurrent uploads",
+		Value:   4,
+	},
+}
+
+var trashFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "drive",
+		Usage: "shared drive id, My Drive if empty",
+	},
+}
+
+var headsFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:     "drive",
+		Aliases:  []string{"d"},
+		Usage:    "body drive id or drive:/path",
+		Required: true,
+	},
+	&cli.StringFlag{
+		Name:     "parentId",
+		Aliases:  []string{"p"},
+		Usage:    "head parent dir id",
+		Required: true,
+	},
+	&cli.Int64Flag{
+		Name:  "head-size",
+		Usage: "head size (KiB)",
+		Value: 64,
+	},
+	&cli.StringFlag{
+		Name:  "manifest",
+		Usage: "head/body manifest file",
+		Value: "heads.json",
+	},
+}
+
 func init() {
 	Drive = []*cli.Command{
 		{
@@ -21,10 +111,11 @@ func init() {
 				}
 				group := c.String("group")
 				user := c.String("user")
-				drive.CreateDrive(c.Args().Slice(), c.Int("count"), group, user)
+				drive.CreateDrive(c.Args().Slice(), c.Int("count"), group, user, share(c),
+					c.Bool("if-not-exists"), c.String("requests"))
 				return nil
 			},
-			Flags: []cli.Flag{
+			Flags: append([]cli.Flag{
 				&cli.UintFlag{
 					Name:    "count",
 					Aliases: []string{"c"},
@@ -40,7 +131,16 @@ func init() {
 					Aliases: []string{"u"},
 					Usage:   "Share driver user",
 				},
-			},
+				&cli.BoolFlag{
+					Name:  "if-not-exists",
+					Usage: "reuse an existing drive with the same name",
+				},
+				&cli.StringFlag{
+					Name:  "requests",
+					Usage: "pending create request ids file",
+					Value: "mb-requests.json",
+				},
+			}, shareFlags...),
 		},
 		{
 			Name:  "rb",
@@ -117,51 +217,164 @@ func init() {
 			Usage: "Copy files and objects",
 			Action: func(c *cli.Context) error {
 				if c.NArg() != 2 {
-					return fmt.Errorf("parameter error: file,driveId")
+					return fmt.Errorf("parameter error: file,driveId[:/path]")
 				}
-				if c.IsSet("remote") {
+				if c.IsSet("remote") && c.Bool("recursive") {
+					checkpoint := c.String("checkpoint")
+					if checkpoint == "" {
+						checkpoint = c.Args().Get(0) + ".copy.json"
+					}
+					return drive.CopyRemoteDir(c.Args().Get(0), c.Args().Get(1), c.Int("concurrency"), checkpoint)
+				} else if c.IsSet("remote") {
 					drive.CopyRemote(c.Args().Get(0), c.Args().Get(1))
+				} else if c.Bool("recursive") {
+					return drive.CopyDir(c.Args().Get(0), c.Args().Get(1), c.Int("concurrency"), false)
 				} else {
 					return drive.Copy(c.Args().Get(0), c.Args().Get(1))
 				}
 				return nil
 			},
-			Flags: []cli.Flag{
+			Flags: append([]cli.Flag{
 				&cli.BoolFlag{
-					Name:    "remote",
-					Aliases: []string{"r"},
-					Usage:   "Copy GD remote files",
+					Name:  "remote",
+					Usage: "Copy GD remote files",
 				},
-			},
+				&cli.StringFlag{
+					Name:  "checkpoint",
+					Usage: "remote -r: progress file to resume from (default <folderId>.copy.json)",
+				},
+			}, recursiveFlags...),
 		},
 		{
 			Name:  "mv",
-			Usage: "Moves a local file to drive",
+			Usage: "Moves a local file to drive, or remote files between folders and drives",
 			Action: func(c *cli.Context) error {
+				if c.IsSet("query") {
+					if c.NArg() != 1 {
+						return fmt.Errorf("parameter error: driveId[:/path]")
+					}
+					return drive.MoveQuery(c.String("query"), c.Args().First(), c.Bool("dry-run"))
+				}
+				if c.Bool("remote") {
+					if c.NArg() < 2 {
+						return fmt.Errorf("parameter error: id|driveId:/path ... driveId[:/path]")
+					}
+					args := c.Args().Slice()
+					return drive.MoveRemote(args[:len(args)-1], args[len(args)-1])
+				}
 				if c.NArg() != 2 {
-					return fmt.Errorf("parameter error: file,driveId")
+					return fmt.Errorf("parameter error: file,driveId[:/path]")
+				}
+				if c.Bool("recursive") {
+					return drive.CopyDir(c.Args().Get(0), c.Args().Get(1), c.Int("concurrency"), true)
 				}
 				return drive.Move(c.Args().Get(0), c.Args().Get(1))
 			},
+			Flags: append([]cli.Flag{
+				&cli.BoolFlag{
+					Name:  "remote",
+					Usage: "Move GD remote files given as id or driveId:/path",
+				},
+				&cli.StringFlag{
+					Name:    "query",
+					Aliases: []string{"q"},
+					Usage:   "Move every remote file matching the Drive search query",
+				},
+				&cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "query: only list the matched files",
+				},
+			}, recursiveFlags...),
+		},
+		{
+			Name:      "rename",
+			Usage:     "Rename a remote file or folder",
+			ArgsUsage: "<id> <newname>",
+			Action: func(c *cli.Context) error {
+				if c.NArg() != 2 {
+					return fmt.Errorf("parameter error: id,newname")
+				}
+				return drive.Rename(c.Args().Get(0), c.Args().Get(1))
+			},
+		},
+		{
+			Name:      "mkdir",
+			Usage:     "Create folders",
+			ArgsUsage: "<drive>:/a/b/c ...",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:    "parents",
+					Aliases: []string{"p"},
+					Usage:   "create parent folders as needed",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				if c.NArg() < 1 {
+					return fmt.Errorf("enter a folder path")
+				}
+				drive.Mkdir(c.Args().Slice(), c.Bool("parents"))
+				return nil
+			},
 		},
 		{
 			Name:  "rm",
-			Usage: "Remove objects",
+			Usage: "Move objects to the trash",
 			Action: func(c *cli.Context) error {
-				drive.Remove(c.Args().Slice())
+				drive.Remove(c.Args().Slice(), c.Bool("permanent"))
 				return nil
 			},
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "permanent",
+					Usage: "Delete objects permanently instead of trashing them",
+				},
+			},
+		},
+		{
+			Name:  "trash",
+			Usage: "List, restore or empty trashed objects",
+			Subcommands: []*cli.Command{
+				{
+					Name:  "ls",
+					Usage: "List trashed objects",
+					Flags: trashFlags,
+					Action: func(c *cli.Context) error {
+						drive.ListTrash(c.String("drive"))
+						return nil
+					},
+				},
+				{
+					Name:      "restore",
+					Usage:     "Restore trashed objects",
+					ArgsUsage: "<id> ...",
+					Action: func(c *cli.Context) error {
+						if c.NArg() < 1 {
+							return fmt.Errorf("enter a file id")
+						}
+						drive.RestoreTrash(c.Args().Slice())
+						return nil
+					},
+				},
+				{
+					Name:  "empty",
+					Usage: "Permanently delete all trashed objects",
+					Flags: trashFlags,
+					Action: func(c *cli.Context) error {
+						return drive.EmptyTrash(c.String("drive"))
+					},
+				},
+			},
 		},
 		{
-			Name:  "sync",
-			Usage: "Synchronize content of two drives/directories",
+			Name:      "sync",
+			Usage:     "Synchronize content of two drives/directories",
+			ArgsUsage: "<driveId[:/path]> or <src driveId:/path> <dst driveId:/path>",
 			Flags: []cli.Flag{
 				&cli.StringFlag{
-					Name:     "dir",
-					Aliases:  []string{"d"},
-					Value:    "/mnt/tmp",
-					Usage:    "monitoring directory",
-					Required: true,
+					Name:    "dir",
+					Aliases: []string{"d"},
+					Value:   "/mnt/tmp",
+					Usage:   "monitoring directory",
 				},
 				&cli.DurationFlag{
 					Name:    "time",
@@ -170,25 +383,88 @@ func init() {
 					Value:   time.Minute,
 				},
 				&cli.StringFlag{
-					Name:     "parentId",
-					Aliases:  []string{"p"},
-					Usage:    "head parent dir id",
-					Required: true,
+					Name:    "parentId",
+					Aliases: []string{"p"},
+					Usage:   "head parent dir id",
+				},
+				&cli.Int64Flag{
+					Name:  "head-size",
+					Usage: "head size (KiB)",
+					Value: 64,
+				},
+				&cli.StringFlag{
+					Name:  "manifest",
+					Usage: "head/body manifest file",
+					Value: "heads.json",
+				},
+				&cli.BoolFlag{
+					Name:  "mirror",
+					Usage: "one-way mirror of dir to the drive folder, local files are never deleted",
+				},
+				&cli.BoolFlag{
+					Name:  "delete",
+					Usage: "mirror: trash remote files missing locally",
+				},
+				&cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "mirror and drive to drive: only print what would change",
+				},
+				&cli.IntFlag{
+					Name:    "concurrency",
+					Aliases: []string{"j"},
+					Usage:   "mirror and drive to drive: concurrent uploads or copies",
+					Value:   4,
 				},
 			},
 			Action: func(c *cli.Context) error {
+				if c.NArg() == 2 {
+					return drive.SyncRemote(c.Args().Get(0), c.Args().Get(1), c.Int("concurrency"), c.Bool("dry-run"))
+				}
 				if c.NArg() != 1 {
-					fmt.Println("Please input driveId")
+					fmt.Println("Please input driveId[:/path]")
 					os.Exit(1)
 				}
 				dir := c.String("dir")
 				driveId := c.Args().First()
+				if c.Bool("mirror") {
+					return drive.Mirror(dir, driveId, c.Bool("delete"), c.Bool("dry-run"), c.Int("concurrency"))
+				}
 				t := c.Duration("time")
 				parentId := c.String("parentId")
-				drive.Sync(dir, driveId, t, parentId)
+				if parentId == "" {
+					return fmt.Errorf("please input head parent dir id (-p)")
+				}
+				drive.Sync(dir, driveId, t, parentId, c.Int64("head-size")*1024, c.String("manifest"))
 				return nil
 			},
 		},
+		{
+			Name:  "heads",
+			Usage: "Verify or restore the heads uploaded by sync",
+			Subcommands: []*cli.Command{
+				{
+					Name:  "verify",
+					Usage: "Check every body has a matching head",
+					Flags: append(headsFlags, &cli.BoolFlag{
+						Name:  "deep",
+						Usage: "compare head content with the body",
+					}),
+					Action: func(c *cli.Context) error {
+						return drive.VerifyHeads(c.String("drive"), c.String("parentId"), c.String("manifest"),
+							c.Int64("head-size")*1024, c.Bool("deep"))
+					},
+				},
+				{
+					Name:  "restore",
+					Usage: "Rebuild missing heads from bodies",
+					Flags: headsFlags,
+					Action: func(c *cli.Context) error {
+						return drive.RestoreHeads(c.String("drive"), c.String("parentId"), c.String("manifest"),
+							c.Int64("head-size")*1024)
+					},
+				},
+			},
+		},
 		{
 			Name:  "drive",
 			Usage: "drive manager",
@@ -196,13 +472,13 @@ func init() {
 				{
 					Name:  "addgroup",
 					Usage: "Share to a group",
-					Flags: []cli.Flag{
+					Flags: append([]cli.Flag{
 						&cli.StringFlag{
 							Name:    "group",
 							Aliases: []string{"g"},
 							Usage:   "group email address",
 						},
-					},
+					}, shareFlags...),
 					Action: func(c *cli.Context) error {
 						group := c.String("group")
 						if group == "" {
@@ -214,20 +490,20 @@ func init() {
 							fmt.Println("please input a drive id arg")
 							return nil
 						}
-						drive.AddDriveGroup(driveId, group)
+						drive.AddDriveGroup(driveId, group, share(c))
 						return nil
 					},
 				},
 				{
 					Name:  "adduser",
 					Usage: "Share to a user",
-					Flags: []cli.Flag{
+					Flags: append([]cli.Flag{
 						&cli.StringFlag{
 							Name:    "user",
 							Aliases: []string{"u"},
 							Usage:   "user email address",
 						},
-					},
+					}, shareFlags...),
 					Action: func(c *cli.Context) error {
 						user := c.String("user")
 						if user == "" {
@@ -239,10 +515,254 @@ func init() {
 							fmt.Println("please input a drive id arg")
 							return nil
 						}
-						drive.AddDriveUser(driveId, user)
+						drive.AddDriveUser(driveId, user, share(c))
+						return nil
+					},
+				},
+				{
+					Name:  "adddomain",
+					Usage: "Share to everyone in a domain",
+					Flags: append([]cli.Flag{
+						&cli.StringFlag{
+							Name:    "domain",
+							Aliases: []string{"d"},
+							Usage:   "domain name",
+						},
+					}, linkRoleFlag),
+					Action: func(c *cli.Context) error {
+						domain := c.String("domain")
+						if domain == "" {
+							fmt.Println("please input a domain")
+							return nil
+						}
+						driveId := c.Args().First()
+						if driveId == "" {
+							fmt.Println("please input a drive id arg")
+							return nil
+						}
+						drive.AddDriveDomain(driveId, domain, share(c))
 						return nil
 					},
 				},
+				{
+					Name:  "addanyone",
+					Usage: "Share to anyone with the link",
+					Flags: []cli.Flag{linkRoleFlag},
+					Action: func(c *cli.Context) error {
+						driveId := c.Args().First()
+						if driveId == "" {
+							fmt.Println("please input a drive id arg")
+							return nil
+						}
+						drive.AddDriveAnyone(driveId, share(c))
+						return nil
+					},
+				},
+				{
+					Name:      "update",
+					Usage:     "Update shared drive settings",
+					ArgsUsage: "<driveId>",
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:    "name",
+							Aliases: []string{"n"},
+						},
+						&cli.StringFlag{
+							Name:  "theme",
+							Usage: "theme id",
+						},
+						&cli.StringFlag{
+							Name:  "color",
+							Usage: "color as an rgb hex string",
+						},
+						&cli.BoolFlag{
+							Name: "hidden",
+						},
+						&cli.BoolFlag{
+							Name:  "restrict-domain-users",
+							Usage: "only users of the domain can access",
+						},
+						&cli.BoolFlag{
+							Name:  "copy-requires-writer",
+							Usage: "disable download, copy and print for commenters and readers",
+						},
+						&cli.BoolFlag{
+							Name:  "admin-managed-restrictions",
+							Usage: "only administrators can modify restrictions",
+						},
+						&cli.BoolFlag{
+							Name:  "admin",
+							Usage: "use domain admin access",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						if c.NArg() != 1 {
+							return fmt.Errorf("please input a drive id arg")
+						}
+						return drive.UpdateDrive(c.Args().First(), drive.DriveUpdate{
+							Name:                     c.String("name"),
+							ThemeId:                  c.String("theme"),
+							ColorRgb:                 c.String("color"),
+							Hidden:                   boolFlag(c, "hidden"),
+							DomainUsersOnly:          boolFlag(c, "restrict-domain-users"),
+							CopyRequiresWriter:       boolFlag(c, "copy-requires-writer"),
+							AdminManagedRestrictions: boolFlag(c, "admin-managed-restrictions"),
+						}, c.Bool("admin"))
+					},
+				},
+				{
+					Name:  "apply",
+					Usage: "Create or update drives from a yaml spec",
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:     "file",
+							Aliases:  []string{"f"},
+							Usage:    "drives spec file",
+							Required: true,
+						},
+						&cli.StringFlag{
+							Name:  "requests",
+							Usage: "pending create request ids file",
+							Value: "mb-requests.json",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						return drive.ApplySpec(c.String("file"), c.String("requests"))
+					},
+				},
+				{
+					Name:  "hide",
+					Usage: "Hide drives from the default view",
+					Action: func(c *cli.Context) error {
+						if c.NArg() < 1 {
+							return fmt.Errorf("enter a drive id")
+						}
+						return drive.HideDrive(c.Args().Slice(), true)
+					},
+				},
+				{
+					Name:  "unhide",
+					Usage: "Restore drives to the default view",
+					Action: func(c *cli.Context) error {
+						if c.NArg() < 1 {
+							return fmt.Errorf("enter a drive id")
+						}
+						return drive.HideDrive(c.Args().Slice(), false)
+					},
+				},
+				{
+					Name:  "perms",
+					Usage: "Permissions of a drive or file",
+					Subcommands: []*cli.Command{
+						{
+							Name:      "ls",
+							Usage:     "List permissions",
+							ArgsUsage: "<id>",
+							Flags: []cli.Flag{
+								&cli.BoolFlag{
+									Name:  "json",
+									Usage: "output json",
+								},
+							},
+							Action: func(c *cli.Context) error {
+								if c.NArg() != 1 {
+									return fmt.Errorf("please input a drive or file id")
+								}
+								return drive.ListPermissions(c.Args().First(), c.Bool("json"))
+							},
+						},
+						{
+							Name:      "rm",
+							Usage:     "Revoke a permission",
+							ArgsUsage: "<id> <email|domain|permId>",
+							Action: func(c *cli.Context) error {
+								if c.NArg() != 2 {
+									return fmt.Errorf("parameter error: id,email|permId")
+								}
+								return drive.RemovePermission(c.Args().Get(0), c.Args().Get(1))
+							},
+						},
+						{
+							Name:      "set",
+							Usage:     "Set the role of a user, group or domain",
+							ArgsUsage: "<id> <email|domain> <role>",
+							Flags: []cli.Flag{
+								&cli.StringFlag{
+									Name:    "type",
+									Aliases: []string{"t"},
+									Usage:   "user, group or domain, when the permission is created",
+									Value:   "user",
+								},
+							},
+							Action: func(c *cli.Context) error {
+								if c.NArg() != 3 {
+									return fmt.Errorf("parameter error: id,email,role")
+								}
+								return drive.SetPermission(c.Args().Get(0), c.Args().Get(1), c.Args().Get(2), c.String("type"))
+							},
+						},
+						{
+							Name:  "apply",
+							Usage: "Add and remove permissions across many drives",
+							Flags: []cli.Flag{
+								&cli.StringFlag{
+									Name:  "drives-from",
+									Usage: "file with one drive id per line",
+								},
+								&cli.StringFlag{
+									Name:  "name-prefix",
+									Usage: "all drives whose name starts with the prefix",
+								},
+								&cli.StringSliceFlag{
+									Name:  "add",
+									Usage: "type:email:role (e.g. user:a@x.com:writer, anyone:reader)",
+								},
+								&cli.StringSliceFlag{
+									Name:  "remove",
+									Usage: "type:email (e.g. group:b@x.com, anyone)",
+								},
+								&cli.BoolFlag{
+									Name:  "notify",
+									Usage: "send notification email to added users and groups",
+								},
+								&cli.IntFlag{
+									Name:  "concurrency",
+									Value: 4,
+								},
+							},
+							Action: func(c *cli.Context) error {
+								from, prefix := c.String("drives-from"), c.String("name-prefix")
+								if (from == "") == (prefix == "") {
+									return fmt.Errorf("enter one of --drives-from or --name-prefix")
+								}
+								var adds, removes []*drive.PermChange
+								for _, v := range c.StringSlice("add") {
+									p, err := drive.ParsePermChange(v, true)
+									if err != nil {
+										return err
+									}
+									adds = append(adds, p)
+								}
+								for _, v := range c.StringSlice("remove") {
+									p, err := drive.ParsePermChange(v, false)
+									if err != nil {
+										return err
+									}
+									removes = append(removes, p)
+								}
+								if len(adds)+len(removes) == 0 {
+									return fmt.Errorf("enter --add or --remove")
+								}
+								drives, err := drive.SelectDrives(from, prefix)
+								if err != nil {
+									return err
+								}
+								drive.ApplyPermissions(drives, adds, removes, c.Bool("notify"), c.Int("concurrency"))
+								return nil
+							},
+						},
+					},
+				},
 			},
 		},
 	}
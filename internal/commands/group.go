@@ -8,12 +8,156 @@ import (
 
 var Group []*cli.Command
 
+var jsonFlag = &cli.BoolFlag{
+	Name:  "json",
+	Usage: "output json",
+}
+
+var bulkFlags = []cli.Flag{
+	&cli.IntFlag{
+		Name:  "concurrency",
+		Usage: "concurrent member inserts",
+		Value: 8,
+	},
+	&cli.Float64Flag{
+		Name:  "qps",
+		Usage: "directory api requests per second",
+		Value: 10,
+	},
+}
+
+// requireService stops a group command before it uses the admin service, only created with --subject.
+func requireService(c *cli.Context) error {
+	if c.String("subject") == "" {
+		return fmt.Errorf("group commands require --subject")
+	}
+	return nil
+}
+
 func init() {
 	Group = []*cli.Command{
 		{
 			Name:  "group",
 			Usage: "group manager",
 			Subcommands: []*cli.Command{
+				{
+					Name:  "ls",
+					Usage: "List groups",
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:    "domain",
+							Aliases: []string{"d"},
+							Usage:   "only groups of the domain",
+						},
+						jsonFlag,
+					},
+					Before: requireService,
+					Action: func(c *cli.Context) error {
+						return admin.ListGroups(c.String("domain"), c.Bool("json"))
+					},
+				},
+				{
+					Name:  "create",
+					Usage: "Create a group",
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:    "name",
+							Aliases: []string{"n"},
+							Usage:   "group name",
+						},
+						&cli.StringFlag{
+							Name:  "description",
+							Usage: "group description",
+						},
+					},
+					Before: requireService,
+					Action: func(c *cli.Context) error {
+						if c.NArg() != 1 {
+							return fmt.Errorf("please enter group email")
+						}
+						return admin.CreateGroup(c.Args().First(), c.String("name"), c.String("description"))
+					},
+				},
+				{
+					Name:   "rm",
+					Usage:  "Delete groups",
+					Before: requireService,
+					Action: func(c *cli.Context) error {
+						if c.NArg() < 1 {
+							return fmt.Errorf("please enter group email")
+						}
+						admin.DeleteGroup(c.Args().Slice())
+						return nil
+					},
+				},
+				{
+					Name:   "info",
+					Usage:  "Show group name, description, member count and aliases",
+					Flags:  []cli.Flag{jsonFlag},
+					Before: requireService,
+					Action: func(c *cli.Context) error {
+						if c.NArg() != 1 {
+							return fmt.Errorf("please enter group email")
+						}
+						return admin.GroupInfo(c.Args().First(), c.Bool("json"))
+					},
+				},
+				{
+					Name:  "update",
+					Usage: "Update group email, name or description",
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:  "email",
+							Usage: "new group email",
+						},
+						&cli.StringFlag{
+							Name:    "name",
+							Aliases: []string{"n"},
+							Usage:   "group name",
+						},
+						&cli.StringFlag{
+							Name:  "description",
+							Usage: "group description",
+						},
+					},
+					Before: requireService,
+					Action: func(c *cli.Context) error {
+						if c.NArg() != 1 {
+							return fmt.Errorf("please enter group email")
+						}
+						return admin.UpdateGroup(c.Args().First(), c.String("email"), c.String("name"), c.String("description"))
+					},
+				},
+				{
+					Name:  "sync",
+					Usage: "Reconcile group members with an emails file",
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:     "file",
+							Aliases:  []string{"f"},
+							Usage:    "desired member emails file",
+							Required: true,
+						},
+						&cli.BoolFlag{
+							Name:  "prune",
+							Usage: "remove members not in the file (except owners)",
+						},
+						&cli.BoolFlag{
+							Name:  "dry-run",
+							Usage: "only print the plan",
+						},
+						bulkFlags[0],
+						bulkFlags[1],
+					},
+					Before: requireService,
+					Action: func(c *cli.Context) error {
+						if c.NArg() != 1 {
+							return fmt.Errorf("please enter group email")
+						}
+						return admin.SyncGroupMembers(c.Args().First(), c.String("file"), c.Bool("prune"), c.Bool("dry-run"),
+							c.Int("concurrency"), c.Float64("qps"))
+					},
+				},
 				{
 					Name:  "user",
 					Usage: "user manager",
@@ -30,9 +174,18 @@ func init() {
 								&cli.StringFlag{
 									Name:    "user",
 									Aliases: []string{"u"},
-									Usage:   "user email",
+									Usage:   "user, group or service account email",
 								},
+								&cli.StringFlag{
+									Name:    "role",
+									Aliases: []string{"r"},
+									Usage:   "OWNER, MANAGER or MEMBER",
+									Value:   "MEMBER",
+								},
+								bulkFlags[0],
+								bulkFlags[1],
 							},
+							Before: requireService,
 							Action: func(c *cli.Context) error {
 								if c.NArg() != 1 {
 									return fmt.Errorf("please enter group email")
@@ -43,10 +196,75 @@ func init() {
 									return fmt.Errorf("please enter user or user emails file")
 								}
 								group := c.Args().Get(0)
-								admin.AddGroupMember(group, user, filepath)
+								admin.AddGroupMember(group, user, filepath, c.String("role"), c.Int("concurrency"), c.Float64("qps"))
+								return nil
+							},
+						},
+						{
+							Name:  "ls",
+							Usage: "list members",
+							Flags: []cli.Flag{
+								&cli.StringFlag{
+									Name:    "role",
+									Aliases: []string{"r"},
+									Usage:   "comma separated roles: OWNER,MANAGER,MEMBER",
+								},
+								&cli.StringFlag{
+									Name:    "type",
+									Aliases: []string{"t"},
+									Usage:   "USER, GROUP, CUSTOMER or EXTERNAL",
+								},
+								jsonFlag,
+							},
+							Before: requireService,
+							Action: func(c *cli.Context) error {
+								if c.NArg() != 1 {
+									return fmt.Errorf("please enter group email")
+								}
+								return admin.ListGroupMembers(c.Args().First(), c.String("role"), c.String("type"), c.Bool("json"))
+							},
+						},
+						{
+							Name:  "rm",
+							Usage: "remove user",
+							Flags: []cli.Flag{
+								&cli.StringFlag{
+									Name:    "file",
+									Aliases: []string{"f"},
+									Usage:   "user emails file",
+								},
+								&cli.StringFlag{
+									Name:    "user",
+									Aliases: []string{"u"},
+									Usage:   "user email",
+								},
+							},
+							Before: requireService,
+							Action: func(c *cli.Context) error {
+								if c.NArg() != 1 {
+									return fmt.Errorf("please enter group email")
+								}
+								user := c.String("user")
+								filepath := c.String("file")
+								if user == "" && filepath == "" {
+									return fmt.Errorf("please enter user or user emails file")
+								}
+								admin.RemoveGroupMember(c.Args().First(), user, filepath)
 								return nil
 							},
 						},
+						{
+							Name:      "role",
+							Usage:     "change member role",
+							ArgsUsage: "<group> <user> OWNER|MANAGER|MEMBER",
+							Before:    requireService,
+							Action: func(c *cli.Context) error {
+								if c.NArg() != 3 {
+									return fmt.Errorf("parameter error: group,user,role")
+								}
+								return admin.SetGroupMemberRole(c.Args().Get(0), c.Args().Get(1), c.Args().Get(2))
+							},
+						},
 					},
 				},
 			},
@@ -0,0 +1,112 @@
+package commands
+
+import (
+	"fmt"
+	"github.com/lnzx/gdc/internal/admin"
+	"github.com/lnzx/gdc/internal/sa"
+	"github.com/urfave/cli/v2"
+)
+
+var SA []*cli.Command
+
+func init() {
+	SA = []*cli.Command{
+		{
+			Name:  "sa",
+			Usage: "service account manager",
+			Subcommands: []*cli.Command{
+				{
+					Name:  "create",
+					Usage: "Create service accounts and their keys",
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:     "project",
+							Usage:    "google cloud project id",
+							Required: true,
+						},
+						&cli.IntFlag{
+							Name:    "count",
+							Aliases: []string{"c"},
+							Value:   1,
+						},
+						&cli.IntFlag{
+							Name:  "start",
+							Usage: "first account number",
+							Value: 1,
+						},
+						&cli.StringFlag{
+							Name:  "prefix",
+							Usage: "account id prefix, accounts are named <prefix>-<n>",
+							Value: "gdc",
+						},
+						&cli.StringFlag{
+							Name:    "dir",
+							Aliases: []string{"d"},
+							Usage:   "key files directory",
+							Value:   "sa",
+						},
+						&cli.StringFlag{
+							Name:    "group",
+							Aliases: []string{"g"},
+							Usage:   "add the accounts to the group (requires --subject)",
+						},
+						&cli.StringFlag{
+							Name:  "endpoint",
+							Usage: "iam api endpoint",
+						},
+						&cli.BoolFlag{
+							Name:  "insecure",
+							Usage: "skip authentication, for a local fake endpoint",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						group := c.String("group")
+						if group != "" && c.String("subject") == "" {
+							return fmt.Errorf("adding to a group requires --subject")
+						}
+						if err := sa.InitService(c.String("sa"), c.String("endpoint"), c.Bool("insecure")); err != nil {
+							return err
+						}
+						emails, err := sa.Create(c.String("project"), c.String("prefix"), c.Int("start"), c.Int("count"), c.String("dir"))
+						if err != nil {
+							return err
+						}
+						if group != "" {
+							admin.AddGroupMembers(group, emails, "MEMBER", 8, 10)
+						}
+						return nil
+					},
+				},
+				{
+					Name:  "check",
+					Usage: "Check every key can access the drive",
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:     "drive",
+							Usage:    "target drive id",
+							Required: true,
+						},
+						&cli.StringFlag{
+							Name:    "dir",
+							Aliases: []string{"d"},
+							Usage:   "key files directory",
+							Value:   "sa",
+						},
+						&cli.StringFlag{
+							Name:    "quarantine",
+							Aliases: []string{"q"},
+							Usage:   "move invalid and no-access keys into the folder",
+						},
+						&cli.IntFlag{
+							Name:  "concurrency",
+							Value: 8,
+						},
+					},
+					Action: func(c *cli.Context) error {
+						return sa.Check(c.String("dir"), c.String("drive"), c.String("quarantine"), c.Int("concurrency"))
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,94 @@
+package commands
+
+import (
+	"github.com/lnzx/gdc/internal/drive"
+	"github.com/urfave/cli/v2"
+)
+
+var Serve []*cli.Command
+
+func init() {
+	Serve = []*cli.Command{
+		{
+			Name:  "serve",
+			Usage: "Serve a drive over network protocols",
+			Subcommands: []*cli.Command{
+				{
+					Name:  "http",
+					Usage: "Read-only http gateway with range support",
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:     "drive",
+							Aliases:  []string{"d"},
+							Usage:    "shared drive id",
+							Required: true,
+						},
+						&cli.StringFlag{
+							Name:    "addr",
+							Aliases: []string{"a"},
+							Usage:   "listen address",
+							Value:   ":8080",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						return drive.ServeHTTP(c.String("addr"), c.String("drive"))
+					},
+				},
+				{
+					Name:  "webdav",
+					Usage: "WebDAV server backed by a shared drive",
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:     "drive",
+							Aliases:  []string{"d"},
+							Usage:    "shared drive id",
+							Required: true,
+						},
+						&cli.StringFlag{
+							Name:    "addr",
+							Aliases: []string{"a"},
+							Usage:   "listen address",
+							Value:   ":8081",
+						},
+						&cli.StringFlag{
+							Name:    "users",
+							Aliases: []string{"u"},
+							Usage:   "basic auth users file, one user:password per line",
+						},
+						&cli.BoolFlag{
+							Name:  "insecure",
+							Usage: "serve without a users file, every request gets full access",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						return drive.ServeWebDAV(c.String("addr"), c.String("drive"), c.String("users"), c.Bool("insecure"))
+					},
+				},
+				{
+					Name:  "s3",
+					Usage: "S3 compatible gateway, every shared drive is a bucket named by its id",
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:    "addr",
+							Aliases: []string{"a"},
+							Usage:   "listen address",
+							Value:   ":9000",
+						},
+						&cli.StringFlag{
+							Name:    "keys",
+							Aliases: []string{"k"},
+							Usage:   `access keys file: {"<access key id>": {"secret": "...", "sa": "sa.json"}}`,
+						},
+						&cli.BoolFlag{
+							Name:  "insecure",
+							Usage: "serve without a keys file, every request gets full access",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						return drive.ServeS3(c.String("addr"), c.String("keys"), c.Bool("insecure"))
+					},
+				},
+			},
+		},
+	}
+}
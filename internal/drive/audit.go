@@ -0,0 +1,120 @@
+package drive
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	flagExternal    = "external-domain"
+	flagAnyone      = "anyone-link"
+	flagNoOrganizer = "no-organizer"
+	flagNotAllowed  = "not-in-allow-group"
+)
+
+type permAudit struct {
+	Id    string   `json:"id"`
+	Type  string   `json:"type"`
+	Role  string   `json:"role"`
+	Who   string   `json:"who"`
+	Flags []string `json:"flags,omitempty"`
+}
+
+type driveAudit struct {
+	Id          string       `json:"id"`
+	Name        string       `json:"name"`
+	Flags       []string     `json:"flags,omitempty"`
+	Permissions []*permAudit `json:"permissions"`
+	Error       string       `json:"error,omitempty"`
+}
+
+// AuditPermissions walks every shared drive and reports its permissions, flagging external domains,
+// anyone links, drives without organizers and members missing from allowed (when not nil).
+func AuditPermissions(w io.Writer, format string, adminAccess bool, internalDomains []string, allowed map[string]bool) error {
+	if format != "csv" && format != "json" {
+		return fmt.Errorf("invalid format: %s, must be csv or json", format)
+	}
+	drives, err := allDrives(adminAccess)
+	if err != nil {
+		return err
+	}
+	internal := make(map[string]bool)
+	for _, d := range internalDomains {
+		internal[strings.ToLower(d)] = true
+	}
+	var audits []*driveAudit
+	for _, d := range drives {
+		a := &driveAudit{Id: d.Id, Name: d.Name}
+		audits = append(audits, a)
+		perms, err := listPermissions(service, d.Id, adminAccess)
+		if err != nil {
+			a.Error = err.Error()
+			continue
+		}
+		organizer := false
+		for _, p := range perms {
+			if p.Deleted {
+				continue
+			}
+			pa := &permAudit{Id: p.Id, Type: p.Type, Role: p.Role, Who: strings.ToLower(p.EmailAddress)}
+			switch p.Type {
+			case "anyone":
+				pa.Who = "anyone"
+				pa.Flags = append(pa.Flags, flagAnyone)
+			case "domain":
+				pa.Who = strings.ToLower(p.Domain)
+				if len(internal) > 0 && !internal[pa.Who] {
+					pa.Flags = append(pa.Flags, flagExternal)
+				}
+			default:
+				if i := strings.LastIndex(pa.Who, "@"); len(internal) > 0 && i != -1 && !internal[pa.Who[i+1:]] {
+					pa.Flags = append(pa.Flags, flagExternal)
+				}
+				if allowed != nil && !allowed[pa.Who] {
+					pa.Flags = append(pa.Flags, flagNotAllowed)
+				}
+			}
+			if p.Role == "organizer" {
+				organizer = true
+			}
+			a.Permissions = append(a.Permissions, pa)
+			for _, f := range pa.Flags {
+				a.addFlag(f)
+			}
+		}
+		if !organizer {
+			a.addFlag(flagNoOrganizer)
+		}
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(audits)
+	}
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"drive_id", "drive_name", "drive_flags", "permission_id", "type", "role", "who", "flags", "error"})
+	for _, a := range audits {
+		driveFlags := strings.Join(a.Flags, ";")
+		if len(a.Permissions) == 0 {
+			cw.Write([]string{a.Id, a.Name, driveFlags, "", "", "", "", "", a.Error})
+		}
+		for _, p := range a.Permissions {
+			cw.Write([]string{a.Id, a.Name, driveFlags, p.Id, p.Type, p.Role, p.Who, strings.Join(p.Flags, ";"), ""})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func (a *driveAudit) addFlag(flag string) {
+	for _, f := range a.Flags {
+		if f == flag {
+			return
+		}
+	}
+	a.Flags = append(a.Flags, flag)
+}
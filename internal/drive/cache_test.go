@@ -0,0 +1,181 @@
+package drive
+
+import (
+	"bytes"
+	"context"
+	"github.com/lnzx/gdc/internal/cache"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		ranges     string
+		size       int64
+		start, end int64
+		wantErr    bool
+	}{
+		{ranges: "", size: 10, start: 0, end: 9},
+		{ranges: "0-0", size: 10, start: 0, end: 0},
+		{ranges: "2-5", size: 10, start: 2, end: 5},
+		{ranges: "5-", size: 10, start: 5, end: 9},
+		{ranges: "-3", size: 10, start: 7, end: 9},
+		{ranges: "-30", size: 10, start: 0, end: 9},
+		{ranges: "8-20", size: 10, start: 8, end: 9},
+		{ranges: "10-", size: 10, wantErr: true},
+		{ranges: "12-20", size: 10, wantErr: true},
+		{ranges: "5-2", size: 10, wantErr: true},
+		{ranges: "5", size: 10, wantErr: true},
+		{ranges: "a-b", size: 10, wantErr: true},
+		{ranges: "1-b", size: 10, wantErr: true},
+		{ranges: "-b", size: 10, wantErr: true},
+	}
+	for _, tt := range tests {
+		start, end, err := parseRange(tt.ranges, tt.size)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseRange(%q, %d) = %d-%d, want error", tt.ranges, tt.size, start, end)
+			}
+			continue
+		}
+		if err != nil || start != tt.start || end != tt.end {
+			t.Errorf("parseRange(%q, %d) = %d-%d %v, want %d-%d", tt.ranges, tt.size, start, end, err, tt.start, tt.end)
+		}
+	}
+}
+
+// fakeDownloads serves content for every file id and counts the ranged downloads.
+func fakeDownloads(t *testing.T, content string) (*drive.Service, *int32) {
+	var n int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&n, 1)
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(content))
+	}))
+	t.Cleanup(srv.Close)
+	svc, err := drive.NewService(context.Background(), option.WithEndpoint(srv.URL+"/"),
+		option.WithoutAuthentication(), option.WithHTTPClient(srv.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return svc, &n
+}
+
+func TestCachedRead(t *testing.T) {
+	content := "0123456789abcdefghij"
+	svc, downloads := fakeDownloads(t, content)
+	f := &drive.File{Id: "f", Md5Checksum: "md5", Size: int64(len(content))}
+
+	tests := []struct {
+		ranges    string
+		want      string
+		downloads int32
+	}{
+		{ranges: "0-3", want: "0123", downloads: 1},
+		{ranges: "1-2", want: "12", downloads: 0},
+		{ranges: "2-9", want: "23456789", downloads: 2},
+		{ranges: "3-4", want: "34", downloads: 0},
+		{ranges: "-2", want: "ij", downloads: 1},
+		{ranges: "17-", want: "hij", downloads: 0},
+		{ranges: "", want: content, downloads: 1},
+		{ranges: "0-100", want: content, downloads: 0},
+	}
+	var err error
+	old := blockCache
+	defer func() { blockCache = old }()
+	if blockCache, err = cache.New(t.TempDir(), 4, 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		before := atomic.LoadInt32(downloads)
+		var buf bytes.Buffer
+		if err = cachedRead(&buf, svc, f, tt.ranges); err != nil {
+			t.Fatalf("cachedRead(%q): %v", tt.ranges, err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("cachedRead(%q) = %q, want %q", tt.ranges, buf.String(), tt.want)
+		}
+		if d := atomic.LoadInt32(downloads) - before; d != tt.downloads {
+			t.Errorf("cachedRead(%q) made %d downloads, want %d", tt.ranges, d, tt.downloads)
+		}
+	}
+
+	// new content keeps the id but not the md5, nothing cached is served
+	f2 := &drive.File{Id: "f", Md5Checksum: "md5-2", Size: int64(len(content))}
+	before := atomic.LoadInt32(downloads)
+	if err = cachedRead(&bytes.Buffer{}, svc, f2, "0-3"); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(downloads) == before {
+		t.Error("replaced content served from the cache")
+	}
+}
+
+func TestCachedReadRejectsBadBlocks(t *testing.T) {
+	content := "0123456789"
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		ranges  string
+		wantErr bool
+	}{
+		{
+			name: "range ignored",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(content))
+			},
+			ranges:  "4-7",
+			wantErr: true,
+		},
+		{
+			name: "range ignored on the whole file",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(content))
+			},
+			ranges: "",
+		},
+		{
+			name: "short block",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusPartialContent)
+				w.Write([]byte("45"))
+			},
+			ranges:  "4-7",
+			wantErr: true,
+		},
+	}
+	old := blockCache
+	defer func() { blockCache = old }()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(tt.handler)
+			defer srv.Close()
+			svc, err := drive.NewService(context.Background(), option.WithEndpoint(srv.URL+"/"),
+				option.WithoutAuthentication(), option.WithHTTPClient(srv.Client()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// one block for the whole file in the last case, several otherwise
+			bs := int64(4)
+			if tt.ranges == "" {
+				bs = int64(len(content))
+			}
+			if blockCache, err = cache.New(t.TempDir(), bs, 0); err != nil {
+				t.Fatal(err)
+			}
+			f := &drive.File{Id: "f", Md5Checksum: "md5", Size: int64(len(content))}
+			err = cachedRead(&bytes.Buffer{}, svc, f, tt.ranges)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("cachedRead(%q) err = %v, want error %v", tt.ranges, err, tt.wantErr)
+			}
+			if _, ok := blockCache.Get("f-md5", 1); tt.wantErr && ok {
+				t.Error("bad block cached")
+			}
+		})
+	}
+}
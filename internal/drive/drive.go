@@ -3,14 +3,19 @@ package drive
 import (
 	"bufio"
 	"context"
+	crand "crypto/rand"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"golang.org/x/oauth2"
 	"google.golang.org/api/drive/v3"
 	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
+	"io"
 	"io/ioutil"
 	"log"
 	"math/rand"
+	"net/http"
 	"os"
 	"time"
 )
@@ -31,56 +36,190 @@ func InitService(ts oauth2.TokenSource) {
 	}
 }
 
-func CreateDrive(names []string, count int, group string, user string) {
-	for i, name := range names {
+// Share is how a permission is granted: the role and whether an email notification is sent to users and groups.
+type Share struct {
+	Role    string
+	Notify  bool
+	Message string
+}
+
+// CreateDrive creates the drives, with count > 1 every name is expanded to name-1 .. name-count.
+// Request ids are persisted in requestsFile until the drive is created, so a rerun after a failure
+// retries the same request instead of creating a duplicate. With ifNotExists an existing drive of
+// the same name is reused.
+func CreateDrive(names []string, count int, group string, user string, share Share, ifNotExists bool, requestsFile string) {
+	var existing map[string]*drive.Drive
+	if ifNotExists {
+		drives, err := allDrives(false)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		existing = make(map[string]*drive.Drive)
+		for _, d := range drives {
+			existing[d.Name] = d
+		}
+	}
+	requests, err := loadRequests(requestsFile)
+	if err != nil {
+		fmt.Println("load request ids error", err)
+		return
+	}
+	var expanded []string
+	for _, name := range names {
 		if count > 1 {
 			for j := 1; j <= count; j++ {
-				doCreateDrive(i, fmt.Sprintf("%s-%d", names[0], j), group, user)
+				expanded = append(expanded, fmt.Sprintf("%s-%d", name, j))
 			}
 		} else {
-			doCreateDrive(i, name, group, user)
+			expanded = append(expanded, name)
+		}
+	}
+	for i, name := range expanded {
+		if d, ok := existing[name]; ok {
+			fmt.Printf("%d Drive exists id: %s name: %s\n", i, d.Id, name)
+			AddDriveGroup(d.Id, group, share)
+			AddDriveUser(d.Id, user, share)
+			continue
 		}
+		doCreateDrive(i, name, group, user, share, requests, requestsFile)
 	}
 }
 
-func doCreateDrive(index int, name, group, user string) {
-	if d, err := service.Drives.Create(name, &drive.Drive{
-		Name: name,
-	}).Fields("id").Do(); err != nil {
+func doCreateDrive(index int, name, group, user string, share Share, requests map[string]string, requestsFile string) {
+	d, err := createDrive(name, requests, requestsFile)
+	if err != nil {
 		fmt.Println(err)
-	} else {
-		fmt.Printf("%d Create drive id: %s name: %s [OK]\n", index, d.Id, name)
-		AddDriveGroup(d.Id, group)
-		AddDriveUser(d.Id, user)
+		return
 	}
+	fmt.Printf("%d Create drive id: %s name: %s [OK]\n", index, d.Id, name)
+	AddDriveGroup(d.Id, group, share)
+	AddDriveUser(d.Id, user, share)
 }
 
-func AddDriveGroup(driveId, group string) {
-	if group != "" {
-		if _, err := service.Permissions.Create(driveId, &drive.Permission{
-			EmailAddress: group,
-			Role:         "organizer", // owner organizer fileOrganizer writer commenter reader
-			Type:         "group",     // user group domain anyone
-		}).Fields().SupportsAllDrives(true).Do(); err != nil {
-			fmt.Println("add drive group error", err)
-		} else {
-			fmt.Println("add drive group [OK]", group)
+func createDrive(name string, requests map[string]string, requestsFile string) (*drive.Drive, error) {
+	requestId, ok := requests[name]
+	if !ok {
+		requestId = newRequestId()
+		requests[name] = requestId
+		if err := saveRequests(requestsFile, requests); err != nil {
+			return nil, fmt.Errorf("save request ids error %v", err)
+		}
+	}
+	d, err := service.Drives.Create(requestId, &drive.Drive{
+		Name: name,
+	}).Fields("id", "name").Do()
+	var gerr *googleapi.Error
+	if ok && errors.As(err, &gerr) && gerr.Code == http.StatusConflict {
+		// a previous run already created the drive with this request id
+		d, err = findDrive(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	delete(requests, name)
+	if err = saveRequests(requestsFile, requests); err != nil {
+		fmt.Println("save request ids error", err)
+	}
+	return d, nil
+}
+
+func findDrive(name string) (*drive.Drive, error) {
+	drives, err := allDrives(false)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range drives {
+		if d.Name == name {
+			return d, nil
+		}
+	}
+	return nil, fmt.Errorf("drive not found: %s", name)
+}
+
+func loadRequests(file string) (map[string]string, error) {
+	requests := make(map[string]string)
+	b, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return requests, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return requests, json.Unmarshal(b, &requests)
+}
+
+func saveRequests(file string, requests map[string]string) error {
+	if len(requests) == 0 {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return err
 		}
+		return nil
+	}
+	b, err := json.MarshalIndent(requests, "", "  ")
+	if err != nil {
+		return err
 	}
+	return ioutil.WriteFile(file, b, 0600)
 }
 
-func AddDriveUser(driveId, user string) {
+// newRequestId returns a random (version 4) UUID.
+func newRequestId() string {
+	b := make([]byte, 16)
+	if _, err := crand.Read(b); err != nil {
+		log.Fatalln("Unable to generate request id", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+func AddDriveGroup(driveId, group string, share Share) {
+	if group != "" {
+		addDrivePermission(driveId, &drive.Permission{EmailAddress: group, Type: "group"}, share)
+	}
+}
+
+func AddDriveUser(driveId, user string, share Share) {
 	if user != "" {
-		if _, err := service.Permissions.Create(driveId, &drive.Permission{
-			EmailAddress: user,
-			Role:         "organizer", // owner organizer fileOrganizer writer commenter reader
-			Type:         "user",      // user group domain anyone
-		}).Fields().SupportsAllDrives(true).Do(); err != nil {
-			fmt.Println("add drive user error", err)
-		} else {
-			fmt.Println("add drive user [OK]", user)
+		addDrivePermission(driveId, &drive.Permission{EmailAddress: user, Type: "user"}, share)
+	}
+}
+
+func AddDriveDomain(driveId, domain string, share Share) {
+	if domain != "" {
+		addDrivePermission(driveId, &drive.Permission{Domain: domain, Type: "domain"}, share)
+	}
+}
+
+func AddDriveAnyone(driveId string, share Share) {
+	addDrivePermission(driveId, &drive.Permission{Type: "anyone"}, share)
+}
+
+func addDrivePermission(driveId string, perm *drive.Permission, share Share) {
+	if share.Role == "" && (perm.Type == "domain" || perm.Type == "anyone") {
+		share.Role = "reader"
+	} else if share.Role == "" {
+		share.Role = "organizer"
+	}
+	if err := checkShareRole(perm.Type, share.Role); err != nil {
+		fmt.Println(err)
+		return
+	}
+	perm.Role = share.Role // owner organizer fileOrganizer writer commenter reader
+	call := service.Permissions.Create(driveId, perm).Fields().SupportsAllDrives(true)
+	// notification emails are only allowed for users and groups
+	if perm.Type == "user" || perm.Type == "group" {
+		call.SendNotificationEmail(share.Notify)
+		if share.Notify && share.Message != "" {
+			call.EmailMessage(share.Message)
 		}
 	}
+	who := perm.EmailAddress + perm.Domain
+	if _, err := call.Do(); err != nil {
+		fmt.Printf("add drive %s error %s %v\n", perm.Type, who, err)
+	} else {
+		fmt.Printf("add drive %s [OK] %s %s\n", perm.Type, who, perm.Role)
+	}
 }
 
 func List(driveId string) {
@@ -93,15 +232,27 @@ func List(driveId string) {
 
 func listDrives() {
 	fmt.Println("list drives")
-	if list, err := service.Drives.List().Fields("drives/id", "drives/name").Do(); err != nil {
+	if drives, err := allDrives(false); err != nil {
 		fmt.Println(err)
 	} else {
-		for i, v := range list.Drives {
+		for i, v := range drives {
 			fmt.Printf("%d id: %s name: %s\n", i, v.Id, v.Name)
 		}
 	}
 }
 
+// allDrives lists every shared drive, with adminAccess all drives of the domain are listed.
+func allDrives(adminAccess bool) ([]*drive.Drive, error) {
+	var drives []*drive.Drive
+	err := service.Drives.List().PageSize(100).UseDomainAdminAccess(adminAccess).
+		Fields("nextPageToken", "drives(id,name,hidden,restrictions)").
+		Pages(context.Background(), func(list *drive.DriveList) error {
+			drives = append(drives, list.Drives...)
+			return nil
+		})
+	return drives, err
+}
+
 func listFiles(driveId string) {
 	fmt.Println("List drive's files:", driveId)
 	if list, err := service.Files.List().Fields().
@@ -146,31 +297,46 @@ func Cat(fileId string, ranges string, count int, quiet bool, randx int64) {
 }
 
 func doCat(fileId string, ranges string, quiet bool) {
-	call := service.Files.Get(fileId).Fields()
-	if ranges != "" {
-		call.Header().Set("Range", "bytes="+ranges)
-	}
 	start := time.Now()
-	if res, err := call.Download(); err != nil {
+	var w io.Writer = os.Stdout
+	if quiet {
+		w = ioutil.Discard
+	}
+	if blockCache != nil {
+		f, err := service.Files.Get(fileId).Fields("id", "size", "md5Checksum").SupportsAllDrives(true).Do()
+		if err == nil {
+			err = cachedRead(w, service, f, ranges)
+		}
+		if err != nil {
+			log.Panicln(err)
+		}
+	} else if res, err := download(service, fileId, ranges); err != nil {
 		log.Panicln(err)
 	} else {
 		defer res.Body.Close()
-		if !quiet {
-			reader := bufio.NewReaderSize(res.Body, googleapi.MinUploadChunkSize)
-			reader.WriteTo(os.Stdout)
-		} else {
-			reader := bufio.NewReaderSize(res.Body, googleapi.MinUploadChunkSize)
-			b, err := ioutil.ReadAll(reader)
-			if err != nil {
-				log.Panicln(err)
-			}
-			_ = b
+		reader := bufio.NewReaderSize(res.Body, googleapi.MinUploadChunkSize)
+		if _, err = reader.WriteTo(w); err != nil && quiet {
+			log.Panicln(err)
 		}
 	}
 	fmt.Printf("\nCat file: %s range: %s time:%s \n", fileId, ranges, time.Since(start))
 }
 
-func Copy(filepath string, driveId string) error {
+func download(svc *drive.Service, fileId string, ranges string) (*http.Response, error) {
+	call := svc.Files.Get(fileId).Fields()
+	if ranges != "" {
+		call.Header().Set("Range", "bytes="+ranges)
+	}
+	return call.Download()
+}
+
+// Copy uploads the local file to dest, a drive id or drive:/path whose folders are created as needed.
+func Copy(filepath string, dest string) error {
+	parentId, err := resolveDest(service, dest)
+	if err != nil {
+		fmt.Println("Resolve destination err", dest, err)
+		return err
+	}
 	media, err := os.Open(filepath)
 	if err != nil {
 		fmt.Println("Open file err", filepath, err)
@@ -186,7 +352,7 @@ func Copy(filepath string, driveId string) error {
 		Name: stat.Name(),
 		//FileExtension: path.Ext(filepath),
 		//FullFileExtension: "",
-		Parents: []string{driveId},
+		Parents: []string{parentId},
 	}
 	reader := bufio.NewReaderSize(media, uploadChunkSize)
 	file, err := service.Files.Create(meta).SupportsAllDrives(true).Fields("id").Media(reader).Do()
@@ -198,7 +364,12 @@ func Copy(filepath string, driveId string) error {
 	return nil
 }
 
-func CopyRemote(fileId string, driveId string) {
+func CopyRemote(fileId string, dest string) {
+	parentId, err := resolveDest(service, dest)
+	if err != nil {
+		fmt.Println("CopyRemote destination error", err)
+		return
+	}
 	src, err := service.Files.Get(fileId).Fields("name").SupportsAllDrives(true).Do()
 	if err != nil {
 		fmt.Println("CopyRemote get error", err)
@@ -206,7 +377,7 @@ func CopyRemote(fileId string, driveId string) {
 	}
 	_, err = service.Files.Copy(fileId, &drive.File{
 		Name:    src.Name,
-		Parents: []string{driveId},
+		Parents: []string{parentId},
 	}).Fields().SupportsAllDrives(true).Do()
 	if err != nil {
 		fmt.Println("CopyRemote error", err)
@@ -216,20 +387,29 @@ func CopyRemote(fileId string, driveId string) {
 	}
 }
 
-func Move(filepath string, driveId string) error {
-	err := Copy(filepath, driveId)
+func Move(filepath string, dest string) error {
+	err := Copy(filepath, dest)
 	if err == nil {
 		fmt.Println("remove local file", os.Remove(filepath))
 	}
 	return err
 }
 
-func Remove(fileIds []string) {
-	for i, id := range fileIds {
-		if err := service.Files.Delete(id).SupportsAllDrives(true).Fields().Do(); err != nil {
-			fmt.Println(err)
+// Mkdir creates folders given as drive:/path, with parents missing parent folders are created too.
+func Mkdir(paths []string, parents bool) {
+	for i, p := range paths {
+		driveId, path := parseRemote(p)
+		var f *drive.File
+		var err error
+		if parents {
+			f, err = mkdirAll(service, driveId, path)
+		} else {
+			f, err = mkdir(service, driveId, path)
+		}
+		if err != nil {
+			fmt.Println("mkdir", p, err)
 		} else {
-			fmt.Printf("%d Delete file: %s [OK]\n", i, id)
+			fmt.Printf("%d mkdir: %s id: %s [OK]\n", i, p, f.Id)
 		}
 	}
 }
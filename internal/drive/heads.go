@@ -0,0 +1,269 @@
+package drive
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"google.golang.org/api/drive/v3"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+)
+
+// headEntry links the head file uploaded by head.json to its body in the shared drive.
+type headEntry struct {
+	HeadId   string `json:"headId"`
+	BodyId   string `json:"bodyId"`
+	HeadSize int64  `json:"headSize"`
+	Size     int64  `json:"size"`
+	// Full marks a body holding the whole file, head included. Bodies of older syncs start after
+	// the head, their heads can be neither compared with nor rebuilt from the body.
+	Full bool `json:"full"`
+}
+
+type headManifest struct {
+	path string
+	size int64
+
+	mu      sync.Mutex
+	entries map[string]*headEntry
+}
+
+var heads *headManifest
+
+func (m *headManifest) load() error {
+	m.entries = make(map[string]*headEntry)
+	if m.path == "" {
+		return nil
+	}
+	b, err := ioutil.ReadFile(m.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, &m.entries)
+}
+
+func (m *headManifest) save() error {
+	if m.path == "" {
+		return nil
+	}
+	// uploads save concurrently, the lock covers the write and rename of the shared tmp file
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, err := json.MarshalIndent(m.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := m.path + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.path)
+}
+
+func (m *headManifest) put(name string, e *headEntry) {
+	m.mu.Lock()
+	m.entries[name] = e
+	m.mu.Unlock()
+}
+
+func (m *headManifest) get(name string) *headEntry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.entries[name]
+}
+
+// byBody indexes the entries by body id.
+func (m *headManifest) byBody() map[string]*headEntry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entries := make(map[string]*headEntry, len(m.entries))
+	for _, e := range m.entries {
+		entries[e.BodyId] = e
+	}
+	return entries
+}
+
+type headCheck struct {
+	body   *drive.File
+	head   *drive.File
+	size   int64
+	full   bool
+	status string
+}
+
+// checkHeads matches every body in the drive:/path folder with the head of the same name in parentId.
+func checkHeads(dest, parentId string, deep bool) ([]*headCheck, []*drive.File, error) {
+	driveId, path := parseRemote(dest)
+	folder, err := resolvePath(service, driveId, path)
+	if err != nil {
+		return nil, nil, err
+	}
+	bodies, err := listChildren(service, driveId, folder.Id)
+	if err != nil {
+		return nil, nil, err
+	}
+	files, err := listChildren(headSvc, "", parentId)
+	if err != nil {
+		return nil, nil, err
+	}
+	headsById := make(map[string]*drive.File)
+	headsByName := make(map[string]*drive.File)
+	for _, f := range files {
+		headsById[f.Id] = f
+		headsByName[f.Name] = f
+	}
+	entries := heads.byBody()
+	// bodies in the manifest are matched by head id, the others by name
+	matched := make(map[string]bool)
+	var checks []*headCheck
+	for _, body := range bodies {
+		if isFolder(body) {
+			continue
+		}
+		c := &headCheck{body: body, size: heads.size}
+		if e := entries[body.Id]; e != nil {
+			c.head = headsById[e.HeadId]
+			c.full = e.Full
+			if e.HeadSize > 0 {
+				c.size = e.HeadSize
+			}
+		} else if h := headsByName[body.Name]; h != nil && !matched[h.Id] {
+			c.head = h
+		}
+		if c.size > body.Size {
+			c.size = body.Size
+		}
+		if c.head != nil {
+			matched[c.head.Id] = true
+		}
+		switch {
+		case c.head == nil:
+			c.status = "missing"
+		case c.head.Size != c.size:
+			c.status = "size mismatch"
+		case deep && !c.full:
+			c.status = "legacy"
+		case deep:
+			b, err := readHead(body.Id, c.size)
+			if err != nil {
+				return nil, nil, err
+			}
+			sum := md5.Sum(b)
+			if hex.EncodeToString(sum[:]) != c.head.Md5Checksum {
+				c.status = "content mismatch"
+			} else {
+				c.status = "ok"
+			}
+		default:
+			c.status = "ok"
+		}
+		checks = append(checks, c)
+	}
+	var orphans []*drive.File
+	for _, f := range files {
+		if !matched[f.Id] {
+			orphans = append(orphans, f)
+		}
+	}
+	sort.Slice(orphans, func(i, j int) bool { return orphans[i].Name < orphans[j].Name })
+	return checks, orphans, nil
+}
+
+func readHead(bodyId string, size int64) ([]byte, error) {
+	if size <= 0 {
+		return nil, nil
+	}
+	res, err := download(service, bodyId, fmt.Sprintf("0-%d", size-1))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	return ioutil.ReadAll(res.Body)
+}
+
+func initHeads(manifest string, headSize int64) error {
+	initHead()
+	heads = &headManifest{path: manifest, size: headSize}
+	return heads.load()
+}
+
+// VerifyHeads reports bodies without a matching head, with deep the head content is compared to the body.
+func VerifyHeads(dest, parentId, manifest string, headSize int64, deep bool) error {
+	if err := initHeads(manifest, headSize); err != nil {
+		return err
+	}
+	checks, orphans, err := checkHeads(dest, parentId, deep)
+	if err != nil {
+		return err
+	}
+	bad := 0
+	for i, c := range checks {
+		// legacy bodies start after their head, only the head size can be checked
+		if c.status != "ok" && c.status != "legacy" {
+			bad++
+		}
+		fmt.Printf("%d %s body: %s size: %d head: %d [%s]\n", i, c.body.Name, c.body.Id, c.body.Size, c.size, c.status)
+	}
+	for _, f := range orphans {
+		fmt.Printf("orphan head: %s id: %s\n", f.Name, f.Id)
+	}
+	fmt.Printf("bodies: %d bad: %d orphan heads: %d\n", len(checks), bad, len(orphans))
+	if bad > 0 {
+		return fmt.Errorf("%d bodies without a valid head", bad)
+	}
+	return nil
+}
+
+// RestoreHeads rebuilds missing or broken heads from the first bytes of their bodies.
+func RestoreHeads(dest, parentId, manifest string, headSize int64) error {
+	if err := initHeads(manifest, headSize); err != nil {
+		return err
+	}
+	checks, _, err := checkHeads(dest, parentId, false)
+	if err != nil {
+		return err
+	}
+	restored, failed, legacy := 0, 0, 0
+	for _, c := range checks {
+		if c.status == "ok" {
+			if heads.get(c.body.Name) == nil {
+				heads.put(c.body.Name, &headEntry{HeadId: c.head.Id, BodyId: c.body.Id, HeadSize: c.size, Size: c.body.Size})
+			}
+			continue
+		}
+		if !c.full {
+			legacy++
+			fmt.Println("Skip legacy body, its head cannot be rebuilt:", c.body.Name, c.status)
+			continue
+		}
+		head, err := readHead(c.body.Id, c.size)
+		var headId string
+		if err == nil {
+			headId, err = uploadHead(headSvc, head, c.body.Name, parentId)
+		}
+		if err != nil {
+			failed++
+			fmt.Println("Restore head error", c.body.Name, err)
+			continue
+		}
+		// the broken head is only trashed once its replacement is uploaded
+		if c.head != nil {
+			if err = setTrashed(headSvc, c.head.Id, true); err != nil {
+				fmt.Println("Trash old head error", c.head.Id, err)
+			}
+		}
+		heads.put(c.body.Name, &headEntry{HeadId: headId, BodyId: c.body.Id, HeadSize: int64(len(head)), Size: c.body.Size, Full: true})
+		restored++
+		fmt.Printf("Restore head: %s id: %s [OK]\n", c.body.Name, headId)
+	}
+	if err = heads.save(); err != nil {
+		return err
+	}
+	fmt.Printf("restored: %d failed: %d legacy: %d\n", restored, failed, legacy)
+	return nil
+}
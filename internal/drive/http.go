@@ -0,0 +1,172 @@
+package drive
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type httpGateway struct {
+	svc     *drive.Service
+	driveId string
+}
+
+type entryInfo struct {
+	Id           string `json:"id"`
+	Name         string `json:"name"`
+	MimeType     string `json:"mimeType"`
+	Size         int64  `json:"size"`
+	ModifiedTime string `json:"modifiedTime"`
+	Dir          bool   `json:"dir"`
+}
+
+var listingTmpl = template.Must(template.New("listing").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Path}}</title></head>
+<body><h1>{{.Path}}</h1><pre>
+{{- if ne .Path "/"}}
+<a href="../">../</a>{{end}}
+{{range .Entries}}<a href="{{.Name}}{{if .Dir}}/{{end}}">{{.Name}}{{if .Dir}}/{{end}}</a>  {{.Size}}  {{.ModifiedTime}}
+{{end}}</pre></body></html>
+`))
+
+// ServeHTTP exposes the shared drive read-only over HTTP, range requests are passed through to drive.
+func ServeHTTP(addr string, driveId string) error {
+	log.Println("Serve http:", addr, "drive:", driveId)
+	return http.ListenAndServe(addr, &httpGateway{svc: service, driveId: driveId})
+}
+
+func (g *httpGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	p := path.Clean("/" + r.URL.Path)
+	f, err := resolvePath(g.svc, g.driveId, p)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	log.Println(r.Method, p, r.Header.Get("Range"))
+	if isFolder(f) {
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			http.Redirect(w, r, r.URL.Path+"/", http.StatusMovedPermanently)
+			return
+		}
+		g.serveDir(w, r, p, f)
+		return
+	}
+	g.serveFile(w, r, f)
+}
+
+func (g *httpGateway) serveDir(w http.ResponseWriter, r *http.Request, p string, dir *drive.File) {
+	files, err := listChildren(g.svc, g.driveId, dir.Id)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	entries := make([]entryInfo, 0, len(files))
+	for _, f := range files {
+		entries = append(entries, entryInfo{
+			Id:           f.Id,
+			Name:         f.Name,
+			MimeType:     f.MimeType,
+			Size:         f.Size,
+			ModifiedTime: f.ModifiedTime,
+			Dir:          isFolder(f),
+		})
+	}
+	if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodGet {
+			json.NewEncoder(w).Encode(entries)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if r.Method == http.MethodGet {
+		listingTmpl.Execute(w, struct {
+			Path    string
+			Entries []entryInfo
+		}{p, entries})
+	}
+}
+
+func (g *httpGateway) serveFile(w http.ResponseWriter, r *http.Request, f *drive.File) {
+	if strings.HasPrefix(f.MimeType, "application/vnd.google-apps.") {
+		http.Error(w, "google apps documents cannot be downloaded", http.StatusNotImplemented)
+		return
+	}
+	h := w.Header()
+	h.Set("Content-Type", f.MimeType)
+	h.Set("Accept-Ranges", "bytes")
+	if f.Md5Checksum != "" {
+		h.Set("ETag", `"`+f.Md5Checksum+`"`)
+	}
+	if t, err := time.Parse(time.RFC3339, f.ModifiedTime); err == nil {
+		h.Set("Last-Modified", t.UTC().Format(http.TimeFormat))
+	}
+	ranges := ""
+	if v := r.Header.Get("Range"); strings.HasPrefix(v, "bytes=") && !strings.Contains(v, ",") {
+		ranges = strings.TrimPrefix(v, "bytes=")
+	}
+	if r.Method == http.MethodHead {
+		h.Set("Content-Length", strconv.FormatInt(f.Size, 10))
+		return
+	}
+
+	if blockCache != nil {
+		start, end, err := parseRange(ranges, f.Size)
+		if err != nil {
+			h.Set("Content-Range", fmt.Sprintf("bytes */%d", f.Size))
+			http.Error(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		h.Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+		if ranges != "" {
+			h.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, f.Size))
+			w.WriteHeader(http.StatusPartialContent)
+		}
+		if err = cachedRead(w, g.svc, f, ranges); err != nil {
+			log.Println("Cached read error", f.Id, err)
+		}
+		return
+	}
+
+	res, err := download(g.svc, f.Id, ranges)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	defer res.Body.Close()
+	for _, k := range []string{"Content-Length", "Content-Range"} {
+		if v := res.Header.Get(k); v != "" {
+			h.Set(k, v)
+		}
+	}
+	w.WriteHeader(res.StatusCode)
+	if _, err = io.Copy(w, res.Body); err != nil {
+		log.Println("Download error", f.Id, err)
+	}
+}
+
+func httpError(w http.ResponseWriter, err error) {
+	code := http.StatusBadGateway
+	var gerr *googleapi.Error
+	if errors.Is(err, errNotFound) {
+		code = http.StatusNotFound
+	} else if errors.As(err, &gerr) {
+		code = gerr.Code
+	}
+	http.Error(w, err.Error(), code)
+}
@@ -0,0 +1,71 @@
+package drive
+
+import (
+	"fmt"
+	"google.golang.org/api/drive/v3"
+)
+
+// DriveUpdate holds the shared drive settings to change, nil fields are left untouched.
+type DriveUpdate struct {
+	Name                     string
+	ThemeId                  string
+	ColorRgb                 string
+	Hidden                   *bool
+	DomainUsersOnly          *bool
+	CopyRequiresWriter       *bool
+	AdminManagedRestrictions *bool
+}
+
+func UpdateDrive(driveId string, u DriveUpdate, adminAccess bool) error {
+	d := &drive.Drive{Name: u.Name, ThemeId: u.ThemeId, ColorRgb: u.ColorRgb}
+	r := &drive.DriveRestrictions{}
+	if u.DomainUsersOnly != nil {
+		r.DomainUsersOnly = *u.DomainUsersOnly
+		r.ForceSendFields = append(r.ForceSendFields, "DomainUsersOnly")
+	}
+	if u.CopyRequiresWriter != nil {
+		r.CopyRequiresWriterPermission = *u.CopyRequiresWriter
+		r.ForceSendFields = append(r.ForceSendFields, "CopyRequiresWriterPermission")
+	}
+	if u.AdminManagedRestrictions != nil {
+		r.AdminManagedRestrictions = *u.AdminManagedRestrictions
+		r.ForceSendFields = append(r.ForceSendFields, "AdminManagedRestrictions")
+	}
+	if len(r.ForceSendFields) > 0 {
+		d.Restrictions = r
+	}
+	if d.Name != "" || d.ThemeId != "" || d.ColorRgb != "" || d.Restrictions != nil {
+		updated, err := service.Drives.Update(driveId, d).UseDomainAdminAccess(adminAccess).
+			Fields("id", "name", "restrictions").Do()
+		if err != nil {
+			return err
+		}
+		res := updated.Restrictions
+		if res == nil {
+			res = &drive.DriveRestrictions{}
+		}
+		fmt.Printf("Update drive id: %s name: %s domainUsersOnly: %v copyRequiresWriter: %v adminManaged: %v [OK]\n",
+			updated.Id, updated.Name, res.DomainUsersOnly, res.CopyRequiresWriterPermission, res.AdminManagedRestrictions)
+	}
+	if u.Hidden != nil {
+		return HideDrive([]string{driveId}, *u.Hidden)
+	}
+	return nil
+}
+
+// HideDrive hides the drives from the default view, or unhides them.
+func HideDrive(driveIds []string, hidden bool) error {
+	for i, driveId := range driveIds {
+		var err error
+		if hidden {
+			_, err = service.Drives.Hide(driveId).Fields("id").Do()
+		} else {
+			_, err = service.Drives.Unhide(driveId).Fields("id").Do()
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d drive: %s hidden: %v [OK]\n", i, driveId, hidden)
+	}
+	return nil
+}
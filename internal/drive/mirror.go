@@ -0,0 +1,171 @@
+package drive
+
+import (
+	"errors"
+	"fmt"
+	"google.golang.org/api/drive/v3"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Mirror makes the drive:/path folder a copy of localDir. New and changed files (by size, mtime
+// and md5) are uploaded, remote extras are trashed only with deleteExtra. Local files are never deleted.
+func Mirror(localDir string, dest string, deleteExtra bool, dryRun bool, concurrency int) error {
+	driveId, p := parseRemote(dest)
+	root, err := resolvePath(service, driveId, p)
+	if errors.Is(err, errNotFound) && !dryRun {
+		root, err = mkdirAll(service, driveId, p)
+	} else if errors.Is(err, errNotFound) {
+		root, err = nil, nil
+	}
+	if err != nil {
+		return err
+	}
+	remote := make(map[string]*drive.File)
+	folders := make(map[string]string)
+	if root != nil {
+		if !isFolder(root) {
+			return fmt.Errorf("not a folder: %s", dest)
+		}
+		if remote, err = listTree(service, driveId, root.Id); err != nil {
+			return err
+		}
+		folders["."] = root.Id
+	}
+
+	jobs, wait := startUploads(concurrency, false)
+	local := make(map[string]bool)
+	// remote folders in place of local files, nothing below them is an extra
+	conflicts := make(map[string]bool)
+	unchanged := 0
+	walkErr := filepath.Walk(localDir, func(lp string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(localDir, lp)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		local[rel] = true
+		f := remote[rel]
+		if info.IsDir() {
+			if f != nil && isFolder(f) {
+				folders[rel] = f.Id
+				return nil
+			} else if f != nil {
+				fmt.Println("conflict, remote is a file:", rel)
+				return filepath.SkipDir
+			}
+			fmt.Println("mkdir", rel)
+			if dryRun {
+				return nil
+			}
+			folder, err := childFolder(driveId, folders[path.Dir(rel)], info.Name())
+			if err != nil {
+				return err
+			}
+			folders[rel] = folder.Id
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		modTime := info.ModTime().UTC().Format(time.RFC3339Nano)
+		reason := ""
+		switch {
+		case f == nil:
+			reason = "new"
+		case isFolder(f):
+			fmt.Println("conflict, remote is a folder:", rel)
+			conflicts[rel] = true
+			return nil
+		case f.Size != info.Size():
+			reason = "size"
+		case sameTime(f.ModifiedTime, info.ModTime()):
+		default:
+			sum, err := fileMd5(lp)
+			if err != nil {
+				return err
+			}
+			if sum != f.Md5Checksum {
+				reason = "md5"
+			} else if !dryRun {
+				// same content, keep the local mtime so the next run skips the md5
+				service.Files.Update(f.Id, &drive.File{ModifiedTime: modTime}).SupportsAllDrives(true).Fields("id").Do()
+			}
+		}
+		if reason == "" {
+			unchanged++
+			return nil
+		}
+		fmt.Printf("upload %s (%s)\n", rel, reason)
+		if !dryRun {
+			jobs <- &uploadJob{
+				path:     lp,
+				name:     info.Name(),
+				parentId: folders[path.Dir(rel)],
+				existing: f,
+				modTime:  modTime,
+				checked:  true,
+			}
+		}
+		return nil
+	})
+	close(jobs)
+	failed := wait()
+	if walkErr != nil {
+		return walkErr
+	}
+
+	var extras []string
+	for rel := range remote {
+		if !local[rel] && !hasAncestor(conflicts, rel) {
+			extras = append(extras, rel)
+		}
+	}
+	sort.Strings(extras)
+	deleted := make(map[string]bool)
+	for _, rel := range extras {
+		// deleting a folder removes everything below it
+		if hasAncestor(deleted, rel) {
+			continue
+		}
+		if !deleteExtra {
+			fmt.Println("extra", rel)
+			continue
+		}
+		fmt.Println("delete", rel)
+		deleted[rel] = true
+		if dryRun {
+			continue
+		}
+		if err = setTrashed(service, remote[rel].Id, true); err != nil {
+			failed++
+			fmt.Println("Trash error", rel, err)
+		}
+	}
+	fmt.Printf("unchanged: %d extra: %d\n", unchanged, len(extras))
+	if failed > 0 {
+		return fmt.Errorf("%d files failed", failed)
+	}
+	return nil
+}
+
+// hasAncestor reports whether a parent folder of rel is in dirs.
+func hasAncestor(dirs map[string]bool, rel string) bool {
+	for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+		if dirs[dir] {
+			return true
+		}
+	}
+	return false
+}
+
+func sameTime(remote string, local time.Time) bool {
+	t, err := time.Parse(time.RFC3339, remote)
+	return err == nil && t.Unix() == local.Unix()
+}
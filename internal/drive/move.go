@@ -0,0 +1,105 @@
+package drive
+
+import (
+	"context"
+	"fmt"
+	"google.golang.org/api/drive/v3"
+	"strings"
+)
+
+// MoveRemote moves files or folders, given as ids or drive:/path, into the dest folder server-side.
+func MoveRemote(srcs []string, dest string) error {
+	parentId, err := resolveDest(service, dest)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, src := range srcs {
+		f, err := remoteFile(src)
+		if err == nil {
+			err = moveFile(f, parentId)
+		}
+		if err != nil {
+			failed++
+			fmt.Println("mv", src, err)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d moves failed", failed)
+	}
+	return nil
+}
+
+// MoveQuery moves every file matching the Drive search query into dest, matches are listed
+// before anything is moved and with dryRun nothing else happens.
+func MoveQuery(query string, dest string, dryRun bool) error {
+	var files []*drive.File
+	err := service.Files.List().Q(query).Corpora("allDrives").
+		SupportsAllDrives(true).IncludeItemsFromAllDrives(true).
+		Fields("nextPageToken", "files("+fileFields+")").
+		Pages(context.Background(), func(list *drive.FileList) error {
+			files = append(files, list.Files...)
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+	for i, f := range files {
+		fmt.Printf("%d id: %s name: %s parents: %s\n", i, f.Id, f.Name, strings.Join(f.Parents, ","))
+	}
+	fmt.Printf("matched: %d\n", len(files))
+	if dryRun {
+		return nil
+	}
+	parentId, err := resolveDest(service, dest)
+	if err != nil {
+		return err
+	}
+	moved, failed := 0, 0
+	for _, f := range files {
+		if f.Id == parentId {
+			continue
+		}
+		if err := moveFile(f, parentId); err != nil {
+			failed++
+			fmt.Println("mv", f.Name, err)
+		} else {
+			moved++
+		}
+	}
+	fmt.Printf("moved: %d failed: %d\n", moved, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d moves failed", failed)
+	}
+	return nil
+}
+
+// Rename changes the name of a file or folder, keeping its id.
+func Rename(fileId, name string) error {
+	f, err := service.Files.Update(fileId, &drive.File{Name: name}).
+		SupportsAllDrives(true).Fields("id,name").Do()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Rename id: %s name: %s [OK]\n", f.Id, f.Name)
+	return nil
+}
+
+func remoteFile(src string) (*drive.File, error) {
+	if strings.Contains(src, ":") {
+		driveId, path := parseRemote(src)
+		return resolvePath(service, driveId, path)
+	}
+	return service.Files.Get(src).Fields(fileFields).SupportsAllDrives(true).Do()
+}
+
+func moveFile(f *drive.File, parentId string) error {
+	_, err := service.Files.Update(f.Id, &drive.File{}).
+		AddParents(parentId).RemoveParents(strings.Join(f.Parents, ",")).
+		SupportsAllDrives(true).Fields("id").Do()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Move id: %s name: %s [OK]\n", f.Id, f.Name)
+	return nil
+}
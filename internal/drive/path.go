@@ -0,0 +1,188 @@
+package drive
+
+import (
+	"errors"
+	"fmt"
+	"google.golang.org/api/drive/v3"
+	"strings"
+)
+
+const folderMimeType = "application/vnd.google-apps.folder"
+
+const fileFields = "id,name,mimeType,size,md5Checksum,modifiedTime,parents"
+
+var errNotFound = errors.New("file not found")
+
+func isFolder(f *drive.File) bool {
+	return f.MimeType == folderMimeType
+}
+
+// listChildren returns all non-trashed children of parentId in the shared drive, or in my drive when driveId is empty.
+func listChildren(svc *drive.Service, driveId, parentId string) ([]*drive.File, error) {
+	var files []*drive.File
+	pageToken := ""
+	for {
+		call := svc.Files.List().
+			SupportsAllDrives(true).
+			IncludeItemsFromAllDrives(true).
+			Q("'"+escapeQuery(parentId)+"' in parents and trashed=false").
+			PageSize(1000).
+			Fields("nextPageToken", "files("+fileFields+")")
+		if driveId != "" {
+			call.Corpora("drive").DriveId(driveId)
+		}
+		if pageToken != "" {
+			call.PageToken(pageToken)
+		}
+		list, err := call.Do()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, list.Files...)
+		if list.NextPageToken == "" {
+			return files, nil
+		}
+		pageToken = list.NextPageToken
+	}
+}
+
+// listTree returns every file and folder below folderId keyed by its slash separated relative path.
+func listTree(svc *drive.Service, driveId, folderId string) (map[string]*drive.File, error) {
+	tree := make(map[string]*drive.File)
+	var walk func(id, prefix string) error
+	walk = func(id, prefix string) error {
+		children, err := listChildren(svc, driveId, id)
+		if err != nil {
+			return err
+		}
+		for _, c := range children {
+			rel := prefix + c.Name
+			tree[rel] = c
+			if isFolder(c) {
+				if err = walk(c.Id, rel+"/"); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return tree, walk(folderId, "")
+}
+
+func findChild(svc *drive.Service, driveId, parentId, name string) (*drive.File, error) {
+	list, err := svc.Files.List().
+		SupportsAllDrives(true).
+		IncludeItemsFromAllDrives(true).
+		Corpora("drive").
+		DriveId(driveId).
+		Q("'" + escapeQuery(parentId) + "' in parents and name='" + escapeQuery(name) + "' and trashed=false").
+		PageSize(1).
+		Fields("files(" + fileFields + ")").Do()
+	if err != nil {
+		return nil, err
+	}
+	if len(list.Files) == 0 {
+		return nil, errNotFound
+	}
+	return list.Files[0], nil
+}
+
+// resolvePath walks a slash separated path from the drive root, the root itself resolves to a folder with the drive id.
+func resolvePath(svc *drive.Service, driveId, path string) (*drive.File, error) {
+	f := &drive.File{Id: driveId, MimeType: folderMimeType}
+	for _, name := range splitPath(path) {
+		if !isFolder(f) {
+			return nil, errNotFound
+		}
+		child, err := findChild(svc, driveId, f.Id, name)
+		if err != nil {
+			return nil, err
+		}
+		f = child
+	}
+	return f, nil
+}
+
+// mkdirAll resolves the folder path from the drive root, creating missing folders on the way.
+func mkdirAll(svc *drive.Service, driveId, path string) (*drive.File, error) {
+	f := &drive.File{Id: driveId, MimeType: folderMimeType}
+	for _, name := range splitPath(path) {
+		child, err := findChild(svc, driveId, f.Id, name)
+		if errors.Is(err, errNotFound) {
+			child, err = svc.Files.Create(&drive.File{
+				Name:     name,
+				MimeType: folderMimeType,
+				Parents:  []string{f.Id},
+			}).SupportsAllDrives(true).Fields(fileFields).Do()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !isFolder(child) {
+			return nil, fmt.Errorf("not a folder: %s", name)
+		}
+		f = child
+	}
+	return f, nil
+}
+
+func mkdir(svc *drive.Service, driveId, path string) (*drive.File, error) {
+	names := splitPath(path)
+	if len(names) == 0 {
+		return nil, fmt.Errorf("folder exists: %s", path)
+	}
+	parent, err := resolvePath(svc, driveId, strings.Join(names[:len(names)-1], "/"))
+	if err != nil {
+		return nil, err
+	}
+	if !isFolder(parent) {
+		return nil, fmt.Errorf("not a folder: %s", parent.Name)
+	}
+	name := names[len(names)-1]
+	if _, err = findChild(svc, driveId, parent.Id, name); err == nil {
+		return nil, fmt.Errorf("folder exists: %s", path)
+	} else if !errors.Is(err, errNotFound) {
+		return nil, err
+	}
+	return svc.Files.Create(&drive.File{
+		Name:     name,
+		MimeType: folderMimeType,
+		Parents:  []string{parent.Id},
+	}).SupportsAllDrives(true).Fields(fileFields).Do()
+}
+
+// parseRemote splits a drive:/path destination, a bare id has an empty path.
+func parseRemote(remote string) (string, string) {
+	if i := strings.Index(remote, ":"); i != -1 {
+		return remote[:i], remote[i+1:]
+	}
+	return remote, ""
+}
+
+// resolveDest returns the folder id of a drive:/path destination, creating missing folders.
+func resolveDest(svc *drive.Service, dest string) (string, error) {
+	driveId, path := parseRemote(dest)
+	if driveId == "" {
+		return "", fmt.Errorf("invalid destination: %s", dest)
+	}
+	folder, err := mkdirAll(svc, driveId, path)
+	if err != nil {
+		return "", err
+	}
+	return folder.Id, nil
+}
+
+func splitPath(path string) []string {
+	var names []string
+	for _, name := range strings.Split(path, "/") {
+		if name != "" && name != "." {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func escapeQuery(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return strings.ReplaceAll(s, `'`, `\'`)
+}
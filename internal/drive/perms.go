@@ -0,0 +1,339 @@
+package drive
+
+import (
+	"encoding/json"
+	"fmt"
+	"google.golang.org/api/drive/v3"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+const permFields = "id,type,role,emailAddress,domain,displayName,deleted"
+
+var roles = []string{"owner", "organizer", "fileOrganizer", "writer", "commenter", "reader"}
+
+func listPermissions(svc *drive.Service, id string, adminAccess bool) ([]*drive.Permission, error) {
+	var perms []*drive.Permission
+	pageToken := ""
+	for {
+		call := svc.Permissions.List(id).SupportsAllDrives(true).UseDomainAdminAccess(adminAccess).PageSize(100).
+			Fields("nextPageToken", "permissions("+permFields+")")
+		if pageToken != "" {
+			call.PageToken(pageToken)
+		}
+		list, err := call.Do()
+		if err != nil {
+			return nil, err
+		}
+		perms = append(perms, list.Permissions...)
+		if list.NextPageToken == "" {
+			return perms, nil
+		}
+		pageToken = list.NextPageToken
+	}
+}
+
+// findPermission matches target against the permission id, email address or domain.
+func findPermission(perms []*drive.Permission, target string) *drive.Permission {
+	for _, p := range perms {
+		if p.Id == target || (p.EmailAddress != "" && strings.EqualFold(p.EmailAddress, target)) ||
+			(p.Type == "domain" && strings.EqualFold(p.Domain, target)) {
+			return p
+		}
+	}
+	return nil
+}
+
+func checkRole(role string) error {
+	for _, r := range roles {
+		if r == role {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid role: %s, must be one of %s", role, strings.Join(roles, ", "))
+}
+
+// checkShareRole also keeps domain and anyone shares from managing the drive.
+func checkShareRole(permType, role string) error {
+	if err := checkRole(role); err != nil {
+		return err
+	}
+	if (permType == "domain" || permType == "anyone") && (role == "organizer" || role == "fileOrganizer") {
+		return fmt.Errorf("role %s is not allowed for %s permissions", role, permType)
+	}
+	return nil
+}
+
+func ListPermissions(id string, jsonOut bool) error {
+	perms, err := listPermissions(service, id, false)
+	if err != nil {
+		return err
+	}
+	if jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(perms)
+	}
+	for i, p := range perms {
+		who := p.EmailAddress
+		if p.Type == "domain" {
+			who = p.Domain
+		} else if p.Type == "anyone" {
+			who = "anyone"
+		}
+		fmt.Printf("%d id: %s type: %s role: %s %s\n", i, p.Id, p.Type, p.Role, who)
+	}
+	return nil
+}
+
+// RemovePermission revokes the permission matching the email, domain or permission id.
+func RemovePermission(id string, target string) error {
+	perms, err := listPermissions(service, id, false)
+	if err != nil {
+		return err
+	}
+	p := findPermission(perms, target)
+	if p == nil {
+		return fmt.Errorf("permission not found: %s", target)
+	}
+	if err = service.Permissions.Delete(id, p.Id).SupportsAllDrives(true).Do(); err != nil {
+		return err
+	}
+	fmt.Printf("Remove permission: %s %s [OK]\n", p.Id, target)
+	return nil
+}
+
+// SetPermission updates the role of the email's permission, creating it with permType when missing.
+// newPermission builds the permission created by SetPermission, email is the domain for domain permissions.
+func newPermission(permType, email, role string) (*drive.Permission, error) {
+	if err := checkShareRole(permType, role); err != nil {
+		return nil, err
+	}
+	perm := &drive.Permission{Type: permType, Role: role}
+	switch permType {
+	case "user", "group":
+		perm.EmailAddress = email
+	case "domain":
+		perm.Domain = email
+	default:
+		return nil, fmt.Errorf("invalid type: %s, must be user, group or domain", permType)
+	}
+	return perm, nil
+}
+
+func SetPermission(id string, email string, role string, permType string) error {
+	perm, err := newPermission(permType, email, role)
+	if err != nil {
+		return err
+	}
+	perms, err := listPermissions(service, id, false)
+	if err != nil {
+		return err
+	}
+	if p := findPermission(perms, email); p != nil {
+		if _, err = service.Permissions.Update(id, p.Id, &drive.Permission{Role: role}).
+			SupportsAllDrives(true).Fields().Do(); err != nil {
+			return err
+		}
+		fmt.Printf("Update permission: %s role: %s [OK]\n", email, role)
+		return nil
+	}
+	if _, err = service.Permissions.Create(id, perm).SupportsAllDrives(true).Fields().Do(); err != nil {
+		return err
+	}
+	fmt.Printf("Create permission: %s role: %s [OK]\n", email, role)
+	return nil
+}
+
+// PermChange is a permission to add (with a role) or remove on a drive.
+type PermChange struct {
+	Type  string
+	Email string
+	Role  string
+}
+
+func (p *PermChange) String() string {
+	s := p.Type
+	if p.Email != "" {
+		s += ":" + p.Email
+	}
+	if p.Role != "" {
+		s += ":" + p.Role
+	}
+	return s
+}
+
+func (p *PermChange) matches(perm *drive.Permission) bool {
+	if p.Type != perm.Type {
+		return false
+	}
+	switch p.Type {
+	case "anyone":
+		return true
+	case "domain":
+		return strings.EqualFold(p.Email, perm.Domain)
+	default:
+		return strings.EqualFold(p.Email, perm.EmailAddress)
+	}
+}
+
+// ParsePermChange parses type:email:role (anyone:role for anyone), the role is omitted for removals.
+func ParsePermChange(s string, withRole bool) (*PermChange, error) {
+	parts := strings.Split(s, ":")
+	p := &PermChange{Type: parts[0]}
+	switch {
+	case p.Type == "anyone" && withRole && len(parts) == 2:
+		p.Role = parts[1]
+	case p.Type == "anyone" && !withRole && len(parts) == 1:
+	case p.Type == "user" || p.Type == "group" || p.Type == "domain":
+		if withRole && len(parts) == 3 {
+			p.Email, p.Role = parts[1], parts[2]
+		} else if !withRole && len(parts) == 2 {
+			p.Email = parts[1]
+		} else {
+			return nil, fmt.Errorf("invalid permission: %s", s)
+		}
+	default:
+		return nil, fmt.Errorf("invalid permission: %s", s)
+	}
+	if withRole {
+		if err := checkShareRole(p.Type, p.Role); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+type applyResult struct {
+	driveId string
+	name    string
+	change  string
+	result  string
+}
+
+// ApplyPermissions adds and removes the permissions on every drive, concurrency drives at a time.
+func ApplyPermissions(drives []*drive.Drive, adds, removes []*PermChange, notify bool, concurrency int) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	results := make([][]applyResult, len(drives))
+	idx := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range idx {
+				results[i] = applyDrivePermissions(drives[i], adds, removes, notify)
+			}
+		}()
+	}
+	for i := range drives {
+		idx <- i
+	}
+	close(idx)
+	wg.Wait()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "DRIVE\tNAME\tCHANGE\tRESULT")
+	for _, rs := range results {
+		for _, r := range rs {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.driveId, r.name, r.change, r.result)
+		}
+	}
+	w.Flush()
+}
+
+func applyDrivePermissions(d *drive.Drive, adds, removes []*PermChange, notify bool) []applyResult {
+	var results []applyResult
+	result := func(change string, err error, ok string) {
+		r := applyResult{driveId: d.Id, name: d.Name, change: change, result: ok}
+		if err != nil {
+			r.result = "error: " + err.Error()
+		}
+		results = append(results, r)
+	}
+	perms, err := listPermissions(service, d.Id, false)
+	if err != nil {
+		result("list", err, "")
+		return results
+	}
+	for _, add := range adds {
+		change := "+" + add.String()
+		var existing *drive.Permission
+		for _, perm := range perms {
+			if add.matches(perm) {
+				existing = perm
+				break
+			}
+		}
+		if existing != nil && existing.Role == add.Role {
+			result(change, nil, "unchanged")
+		} else if existing != nil {
+			_, err = service.Permissions.Update(d.Id, existing.Id, &drive.Permission{Role: add.Role}).
+				SupportsAllDrives(true).Fields().Do()
+			result(change, err, "updated")
+		} else {
+			perm := &drive.Permission{Type: add.Type, Role: add.Role}
+			if add.Type == "domain" {
+				perm.Domain = add.Email
+			} else {
+				perm.EmailAddress = add.Email
+			}
+			call := service.Permissions.Create(d.Id, perm).SupportsAllDrives(true).Fields()
+			if add.Type == "user" || add.Type == "group" {
+				call.SendNotificationEmail(notify)
+			}
+			_, err = call.Do()
+			result(change, err, "added")
+		}
+	}
+	for _, remove := range removes {
+		change := "-" + remove.String()
+		found := false
+		for _, perm := range perms {
+			if remove.matches(perm) {
+				found = true
+				err = service.Permissions.Delete(d.Id, perm.Id).SupportsAllDrives(true).Do()
+				result(change, err, "removed")
+			}
+		}
+		if !found {
+			result(change, nil, "absent")
+		}
+	}
+	return results
+}
+
+// SelectDrives returns the drives listed in the file (one id per line) or whose name starts with prefix.
+func SelectDrives(filepath string, prefix string) ([]*drive.Drive, error) {
+	if filepath != "" {
+		b, err := ioutil.ReadFile(filepath)
+		if err != nil {
+			return nil, err
+		}
+		var drives []*drive.Drive
+		for _, id := range strings.Fields(string(b)) {
+			d, err := service.Drives.Get(id).Fields("id", "name").Do()
+			if err != nil {
+				return nil, fmt.Errorf("drive %s: %v", id, err)
+			}
+			drives = append(drives, d)
+		}
+		return drives, nil
+	}
+	all, err := allDrives(false)
+	if err != nil {
+		return nil, err
+	}
+	var drives []*drive.Drive
+	for _, d := range all {
+		if strings.HasPrefix(d.Name, prefix) {
+			drives = append(drives, d)
+		}
+	}
+	return drives, nil
+}
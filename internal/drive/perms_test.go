@@ -0,0 +1,70 @@
+package drive
+
+import (
+	"google.golang.org/api/drive/v3"
+	"reflect"
+	"testing"
+)
+
+func TestParsePermChange(t *testing.T) {
+	tests := []struct {
+		s        string
+		withRole bool
+		want     *PermChange
+		wantErr  bool
+	}{
+		{s: "user:a@x.com:writer", withRole: true, want: &PermChange{Type: "user", Email: "a@x.com", Role: "writer"}},
+		{s: "group:g@x.com:organizer", withRole: true, want: &PermChange{Type: "group", Email: "g@x.com", Role: "organizer"}},
+		{s: "domain:x.com:reader", withRole: true, want: &PermChange{Type: "domain", Email: "x.com", Role: "reader"}},
+		{s: "anyone:reader", withRole: true, want: &PermChange{Type: "anyone", Role: "reader"}},
+		{s: "group:b@x.com", want: &PermChange{Type: "group", Email: "b@x.com"}},
+		{s: "anyone", want: &PermChange{Type: "anyone"}},
+		{s: "user:a@x.com", withRole: true, wantErr: true},
+		{s: "user:a@x.com:writer", wantErr: true},
+		{s: "user:a@x.com:boss", withRole: true, wantErr: true},
+		{s: "anyone:organizer", withRole: true, wantErr: true},
+		{s: "domain:x.com:fileOrganizer", withRole: true, wantErr: true},
+		{s: "anyone:a@x.com:reader", withRole: true, wantErr: true},
+		{s: "robot:a@x.com:reader", withRole: true, wantErr: true},
+		{s: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParsePermChange(tt.s, tt.withRole)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParsePermChange(%q, %v) = %+v, want error", tt.s, tt.withRole, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParsePermChange(%q, %v) = %+v %v, want %+v", tt.s, tt.withRole, got, err, tt.want)
+		}
+	}
+}
+
+func TestNewPermission(t *testing.T) {
+	tests := []struct {
+		permType, email, role string
+		want                  *drive.Permission
+	}{
+		{permType: "user", email: "a@x.com", role: "writer", want: &drive.Permission{Type: "user", EmailAddress: "a@x.com", Role: "writer"}},
+		{permType: "group", email: "g@x.com", role: "organizer", want: &drive.Permission{Type: "group", EmailAddress: "g@x.com", Role: "organizer"}},
+		{permType: "domain", email: "x.com", role: "reader", want: &drive.Permission{Type: "domain", Domain: "x.com", Role: "reader"}},
+		{permType: "domain", email: "x.com", role: "organizer"},
+		{permType: "anyone", email: "a@x.com", role: "reader"},
+		{permType: "robot", email: "a@x.com", role: "reader"},
+		{permType: "user", email: "a@x.com", role: "boss"},
+	}
+	for _, tt := range tests {
+		got, err := newPermission(tt.permType, tt.email, tt.role)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("newPermission(%q, %q, %q) = %+v, want error", tt.permType, tt.email, tt.role, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("newPermission(%q, %q, %q) = %+v %v, want %+v", tt.permType, tt.email, tt.role, got, err, tt.want)
+		}
+	}
+}
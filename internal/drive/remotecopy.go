@@ -0,0 +1,154 @@
+package drive
+
+import (
+	"encoding/json"
+	"fmt"
+	"google.golang.org/api/drive/v3"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"sync"
+)
+
+// copyCheckpoint maps every copied source id to its copy so an interrupted copy to dest can resume.
+type copyCheckpoint struct {
+	path string
+
+	mu     sync.Mutex
+	Dest   string            `json:"dest"`
+	Copied map[string]string `json:"copied"`
+}
+
+func loadCheckpoint(path, dest string) (*copyCheckpoint, error) {
+	c := &copyCheckpoint{path: path, Dest: dest, Copied: make(map[string]string)}
+	if path == "" {
+		return c, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(b, c); err != nil {
+		return nil, err
+	}
+	if c.Dest != dest {
+		return nil, fmt.Errorf("belongs to a copy to %s, remove it or use another checkpoint", c.Dest)
+	}
+	return c, nil
+}
+
+func (c *copyCheckpoint) get(srcId string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Copied[srcId]
+}
+
+func (c *copyCheckpoint) put(srcId, dstId string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Copied[srcId] = dstId
+	if c.path == "" {
+		return nil
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// CopyRemoteDir copies the folderId folder into dest (drive:/path) server-side, folders are recreated
+// and files copied with Files.Copy. Progress is recorded in checkpoint, a rerun skips what was already copied.
+func CopyRemoteDir(folderId string, dest string, concurrency int, checkpoint string) error {
+	src, err := service.Files.Get(folderId).Fields("id,name,mimeType,driveId").SupportsAllDrives(true).Do()
+	if err != nil {
+		return err
+	}
+	if !isFolder(src) {
+		CopyRemote(folderId, dest)
+		return nil
+	}
+	state, err := loadCheckpoint(checkpoint, dest)
+	if err != nil {
+		return fmt.Errorf("checkpoint %s: %v", checkpoint, err)
+	}
+	tree, err := listTree(service, src.DriveId, src.Id)
+	if err != nil {
+		return err
+	}
+	dstDrive, _ := parseRemote(dest)
+	parentId, err := resolveDest(service, dest)
+	if err != nil {
+		return err
+	}
+	root, err := copyFolder(state, src, dstDrive, parentId)
+	if err != nil {
+		return err
+	}
+
+	var rels []string
+	for rel := range tree {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+	folders := map[string]string{".": root}
+	var jobs []*copyJob
+	skipped, failed := 0, 0
+	for _, rel := range rels {
+		f := tree[rel]
+		parentId, ok := folders[path.Dir(rel)]
+		if !ok {
+			fmt.Println("skip", rel, "parent folder missing")
+			failed++
+			continue
+		}
+		if isFolder(f) {
+			id, err := copyFolder(state, f, dstDrive, parentId)
+			if err != nil {
+				fmt.Println("mkdir error", rel, err)
+				failed++
+				continue
+			}
+			folders[rel] = id
+		} else if state.get(f.Id) != "" {
+			skipped++
+		} else {
+			jobs = append(jobs, &copyJob{rel: rel, src: f, parentId: parentId})
+		}
+	}
+
+	copied, copyFailed := runCopies(jobs, concurrency, func(job *copyJob, f *drive.File) error {
+		return state.put(job.src.Id, f.Id)
+	})
+	failed += copyFailed
+	fmt.Printf("copied: %d skipped: %d failed: %d\n", copied, skipped, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d files failed, rerun to resume", failed)
+	}
+	// the copy is complete, a new run must start over
+	if checkpoint != "" {
+		if err = os.Remove(checkpoint); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyFolder returns the copy of the src folder under parentId, creating it unless the checkpoint has it.
+func copyFolder(state *copyCheckpoint, src *drive.File, driveId, parentId string) (string, error) {
+	if id := state.get(src.Id); id != "" {
+		return id, nil
+	}
+	f, err := childFolder(driveId, parentId, src.Name)
+	if err != nil {
+		return "", err
+	}
+	return f.Id, state.put(src.Id, f.Id)
+}
@@ -0,0 +1,164 @@
+package drive
+
+import (
+	"errors"
+	"fmt"
+	"google.golang.org/api/drive/v3"
+	"path"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+type copyJob struct {
+	rel      string
+	src      *drive.File
+	parentId string
+	existing *drive.File
+}
+
+// SyncRemote replicates the src drive:/path tree into dst with server-side copies,
+// only files missing or different (by size and md5) in dst are copied. Nothing is deleted,
+// the outdated version of a replaced file goes to the trash.
+func SyncRemote(src string, dst string, concurrency int, dryRun bool) error {
+	srcDrive, srcPath := parseRemote(src)
+	srcRoot, err := resolvePath(service, srcDrive, srcPath)
+	if err != nil {
+		return fmt.Errorf("%s: %v", src, err)
+	}
+	if !isFolder(srcRoot) {
+		return fmt.Errorf("not a folder: %s", src)
+	}
+	srcTree, err := listTree(service, srcDrive, srcRoot.Id)
+	if err != nil {
+		return err
+	}
+
+	dstDrive, dstPath := parseRemote(dst)
+	dstRoot, err := resolvePath(service, dstDrive, dstPath)
+	if errors.Is(err, errNotFound) && !dryRun {
+		dstRoot, err = mkdirAll(service, dstDrive, dstPath)
+	} else if errors.Is(err, errNotFound) {
+		dstRoot, err = nil, nil
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", dst, err)
+	}
+	dstTree := make(map[string]*drive.File)
+	folders := make(map[string]string)
+	if dstRoot != nil {
+		if dstTree, err = listTree(service, dstDrive, dstRoot.Id); err != nil {
+			return err
+		}
+		folders["."] = dstRoot.Id
+	}
+
+	var rels []string
+	for rel := range srcTree {
+		rels = append(rels, rel)
+	}
+	// parents sort before their children
+	sort.Strings(rels)
+	var jobs []*copyJob
+	unchanged, failed := 0, 0
+	for _, rel := range rels {
+		f, existing := srcTree[rel], dstTree[rel]
+		if existing != nil && isFolder(f) != isFolder(existing) {
+			// never replace a folder by a file or the other way around
+			fmt.Println("conflict", rel, "folder and file with the same name")
+			failed++
+			continue
+		}
+		parentId, ok := folders[path.Dir(rel)]
+		if !ok && !dryRun {
+			fmt.Println("skip", rel, "parent folder missing")
+			failed++
+			continue
+		}
+		if isFolder(f) {
+			if existing != nil {
+				folders[rel] = existing.Id
+				continue
+			}
+			fmt.Println("mkdir", rel)
+			if dryRun {
+				continue
+			}
+			folder, err := childFolder(dstDrive, parentId, f.Name)
+			if err != nil {
+				fmt.Println("mkdir error", rel, err)
+				failed++
+				continue
+			}
+			folders[rel] = folder.Id
+			continue
+		}
+		if existing != nil && existing.Size == f.Size && existing.Md5Checksum == f.Md5Checksum &&
+			(f.Md5Checksum != "" || existing.MimeType == f.MimeType) {
+			unchanged++
+			continue
+		}
+		jobs = append(jobs, &copyJob{rel: rel, src: f, parentId: parentId, existing: existing})
+	}
+
+	if dryRun {
+		for _, job := range jobs {
+			fmt.Println("copy", job.rel)
+		}
+		fmt.Printf("copy: %d unchanged: %d conflicts: %d\n", len(jobs), unchanged, failed)
+		return nil
+	}
+	// a replaced file goes to the trash, never deleted for good
+	copied, copyFailed := runCopies(jobs, concurrency, func(job *copyJob, _ *drive.File) error {
+		if job.existing == nil {
+			return nil
+		}
+		return setTrashed(service, job.existing.Id, true)
+	})
+	failed += copyFailed
+	fmt.Printf("copied: %d unchanged: %d failed: %d\n", copied, unchanged, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d files failed", failed)
+	}
+	return nil
+}
+
+// runCopies copies the jobs server-side with concurrency workers and prints the progress,
+// done is called after each successful copy. It returns the number of copied and failed jobs.
+func runCopies(jobs []*copyJob, concurrency int, done func(job *copyJob, copied *drive.File) error) (int, int) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	total := len(jobs)
+	var n, failed int32
+	queue := make(chan *copyJob)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				f, err := service.Files.Copy(job.src.Id, &drive.File{
+					Name:    job.src.Name,
+					Parents: []string{job.parentId},
+				}).Fields("id").SupportsAllDrives(true).Do()
+				if err == nil && done != nil {
+					err = done(job, f)
+				}
+				i := atomic.AddInt32(&n, 1)
+				if err != nil {
+					atomic.AddInt32(&failed, 1)
+					fmt.Printf("[%d/%d] copy %s error %v\n", i, total, job.rel, err)
+				} else {
+					fmt.Printf("[%d/%d] copy %s [OK]\n", i, total, job.rel)
+				}
+			}
+		}()
+	}
+	for _, job := range jobs {
+		queue <- job
+	}
+	close(queue)
+	wg.Wait()
+	return total - int(failed), int(failed)
+}
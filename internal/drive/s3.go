@@ -0,0 +1,826 @@
+package drive
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	s3Namespace     = "http://s3.amazonaws.com/doc/2006-03-01/"
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+// s3Key is a static access key, requests signed with it use the drive service of its SA file.
+type s3Key struct {
+	Secret string `json:"secret"`
+	SA     string `json:"sa"`
+}
+
+type s3Gateway struct {
+	// insecure serves every request unauthenticated with the default drive service
+	insecure bool
+	keys     map[string]*s3Key
+	services map[string]*drive.Service
+
+	mu      sync.Mutex
+	uploads map[string]*multipartUpload
+}
+
+type multipartUpload struct {
+	driveId string
+	key     string
+	dir     string
+	// owner is the access key that created the upload
+	owner   string
+	created time.Time
+}
+
+// uploadExpiry is how long the parts of an unfinished multipart upload are kept.
+const uploadExpiry = 24 * time.Hour
+
+type s3Error struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message"`
+	status  int
+}
+
+func (e *s3Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+var (
+	errAccessDenied     = &s3Error{Code: "AccessDenied", Message: "Access Denied", status: http.StatusForbidden}
+	errSignature        = &s3Error{Code: "SignatureDoesNotMatch", Message: "The request signature we calculated does not match the signature you provided", status: http.StatusForbidden}
+	errNoSuchBucket     = &s3Error{Code: "NoSuchBucket", Message: "The specified bucket does not exist", status: http.StatusNotFound}
+	errNoSuchKey        = &s3Error{Code: "NoSuchKey", Message: "The specified key does not exist", status: http.StatusNotFound}
+	errNoSuchUpload     = &s3Error{Code: "NoSuchUpload", Message: "The specified multipart upload does not exist", status: http.StatusNotFound}
+	errInvalidPart      = &s3Error{Code: "InvalidPart", Message: "One or more of the specified parts could not be found", status: http.StatusBadRequest}
+	errBadDigest        = &s3Error{Code: "XAmzContentSHA256Mismatch", Message: "The provided x-amz-content-sha256 header does not match the payload", status: http.StatusBadRequest}
+	errBadUpload        = &s3Error{Code: "BadDigest", Message: "The uploaded content does not match", status: http.StatusBadRequest}
+	errContentMD5       = &s3Error{Code: "BadDigest", Message: "The Content-MD5 you specified did not match what we received", status: http.StatusBadRequest}
+	errTimeSkewed       = &s3Error{Code: "RequestTimeTooSkewed", Message: "The difference between the request time and the server's time is too large", status: http.StatusForbidden}
+	errKeyIsFolder      = &s3Error{Code: "InvalidRequest", Message: "A folder exists with the same name as the key", status: http.StatusConflict}
+	errNotImplemented   = &s3Error{Code: "NotImplemented", Message: "A header or operation you provided is not implemented", status: http.StatusNotImplemented}
+	errMethodNotAllowed = &s3Error{Code: "MethodNotAllowed", Message: "The specified method is not allowed against this resource", status: http.StatusMethodNotAllowed}
+)
+
+// ServeS3 presents every shared drive as a bucket named by its drive id.
+// keysFile maps access key ids to their secret and SA file, it is required unless insecure is set.
+func ServeS3(addr string, keysFile string, insecure bool) error {
+	if keysFile == "" && !insecure {
+		return fmt.Errorf("a keys file is required, use --insecure to serve without authentication")
+	}
+	g := &s3Gateway{
+		insecure: keysFile == "",
+		keys:     make(map[string]*s3Key),
+		services: make(map[string]*drive.Service),
+		uploads:  make(map[string]*multipartUpload),
+	}
+	if keysFile != "" {
+		b, err := ioutil.ReadFile(keysFile)
+		if err != nil {
+			return err
+		}
+		if err = json.Unmarshal(b, &g.keys); err != nil {
+			return fmt.Errorf("parse keys file: %v", err)
+		}
+		for id, k := range g.keys {
+			if k.SA == "" {
+				g.services[id] = service
+				continue
+			}
+			svc, err := drive.NewService(context.Background(), option.WithCredentialsFile(k.SA))
+			if err != nil {
+				return fmt.Errorf("access key %s: %v", id, err)
+			}
+			g.services[id] = svc
+		}
+	}
+	go g.expireUploads()
+	log.Println("Serve s3:", addr, "keys:", len(g.keys))
+	return http.ListenAndServe(addr, g)
+}
+
+func (g *s3Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.URL.RequestURI())
+	svc, accessKey, err := g.authenticate(r)
+	if err != nil {
+		writeS3Error(w, err)
+		return
+	}
+	bucket, key := splitBucketKey(r.URL.Path)
+	q := r.URL.Query()
+	if bucket == "" {
+		if r.Method != http.MethodGet {
+			writeS3Error(w, errMethodNotAllowed)
+			return
+		}
+		err = g.listBuckets(w, svc)
+	} else if key == "" {
+		switch r.Method {
+		case http.MethodGet:
+			if _, ok := q["location"]; ok {
+				err = writeXML(w, http.StatusOK, &struct {
+					XMLName xml.Name `xml:"LocationConstraint"`
+					Xmlns   string   `xml:"xmlns,attr"`
+				}{Xmlns: s3Namespace})
+			} else {
+				err = g.listObjects(w, r, svc, bucket)
+			}
+		case http.MethodHead:
+			_, err = getBucket(svc, bucket)
+		default:
+			err = errMethodNotAllowed
+		}
+	} else {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			err = g.getObject(w, r, svc, bucket, key)
+		case http.MethodPut:
+			if q.Get("uploadId") != "" {
+				err = g.uploadPart(w, r, accessKey, q.Get("uploadId"), q.Get("partNumber"))
+			} else if r.Header.Get("X-Amz-Copy-Source") != "" {
+				err = errNotImplemented
+			} else {
+				err = g.putObject(w, r, svc, bucket, key)
+			}
+		case http.MethodPost:
+			if _, ok := q["uploads"]; ok {
+				err = g.createMultipartUpload(w, svc, accessKey, bucket, key)
+			} else if q.Get("uploadId") != "" {
+				err = g.completeMultipartUpload(w, r, svc, accessKey, q.Get("uploadId"))
+			} else {
+				err = errNotImplemented
+			}
+		case http.MethodDelete:
+			if q.Get("uploadId") != "" {
+				err = g.abortMultipartUpload(w, accessKey, q.Get("uploadId"))
+			} else {
+				err = g.deleteObject(w, svc, bucket, key)
+			}
+		default:
+			err = errMethodNotAllowed
+		}
+	}
+	if err != nil {
+		writeS3Error(w, err)
+	}
+}
+
+func (g *s3Gateway) listBuckets(w http.ResponseWriter, svc *drive.Service) error {
+	type bucket struct {
+		Name         string `xml:"Name"`
+		CreationDate string `xml:"CreationDate"`
+	}
+	result := struct {
+		XMLName xml.Name `xml:"ListAllMyBucketsResult"`
+		Xmlns   string   `xml:"xmlns,attr"`
+		Owner   struct {
+			ID          string `xml:"ID"`
+			DisplayName string `xml:"DisplayName"`
+		} `xml:"Owner"`
+		Buckets []bucket `xml:"Buckets>Bucket"`
+	}{Xmlns: s3Namespace}
+	result.Owner.ID = "gdc"
+	result.Owner.DisplayName = "gdc"
+	err := svc.Drives.List().PageSize(100).Fields("nextPageToken", "drives(id,createdTime)").
+		Pages(context.Background(), func(list *drive.DriveList) error {
+			for _, d := range list.Drives {
+				result.Buckets = append(result.Buckets, bucket{Name: d.Id, CreationDate: d.CreatedTime})
+			}
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+	return writeXML(w, http.StatusOK, &result)
+}
+
+type s3Object struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type s3Prefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+func (g *s3Gateway) listObjects(w http.ResponseWriter, r *http.Request, svc *drive.Service, bucket string) error {
+	driveId, err := getBucket(svc, bucket)
+	if err != nil {
+		return err
+	}
+	q := r.URL.Query()
+	v2 := q.Get("list-type") == "2"
+	prefix, delimiter := q.Get("prefix"), q.Get("delimiter")
+	maxKeys := 1000
+	if v := q.Get("max-keys"); v != "" {
+		if maxKeys, err = strconv.Atoi(v); err != nil || maxKeys < 0 {
+			return &s3Error{Code: "InvalidArgument", Message: "invalid max-keys", status: http.StatusBadRequest}
+		}
+	}
+	after := q.Get("marker")
+	if v2 {
+		after = q.Get("start-after")
+		if token := q.Get("continuation-token"); token != "" {
+			b, err := base64.URLEncoding.DecodeString(token)
+			if err != nil {
+				return &s3Error{Code: "InvalidArgument", Message: "invalid continuation token", status: http.StatusBadRequest}
+			}
+			after = string(b)
+		}
+	}
+
+	type item struct {
+		key  string
+		file *drive.File
+	}
+	var items []item
+	var walk func(folderId, dir string) error
+	walk = func(folderId, dir string) error {
+		children, err := listChildren(svc, driveId, folderId)
+		if err != nil {
+			return err
+		}
+		for _, c := range children {
+			key := dir + c.Name
+			if !isFolder(c) {
+				if strings.HasPrefix(key, prefix) {
+					items = append(items, item{key, c})
+				}
+				continue
+			}
+			key += "/"
+			if delimiter == "/" && strings.HasPrefix(key, prefix) {
+				items = append(items, item{key: key})
+			} else if strings.HasPrefix(key, prefix) || strings.HasPrefix(prefix, key) {
+				if err = walk(c.Id, key); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	base := prefix[:strings.LastIndex(prefix, "/")+1]
+	if folder, err := resolvePath(svc, driveId, base); err == nil && isFolder(folder) {
+		if err = walk(folder.Id, base); err != nil {
+			return err
+		}
+	} else if err != nil && !errors.Is(err, errNotFound) {
+		return err
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].key < items[j].key })
+
+	result := struct {
+		XMLName               xml.Name   `xml:"ListBucketResult"`
+		Xmlns                 string     `xml:"xmlns,attr"`
+		Name                  string     `xml:"Name"`
+		Prefix                string     `xml:"Prefix"`
+		Delimiter             string     `xml:"Delimiter,omitempty"`
+		Marker                *string    `xml:"Marker"`
+		NextMarker            string     `xml:"NextMarker,omitempty"`
+		StartAfter            string     `xml:"StartAfter,omitempty"`
+		ContinuationToken     string     `xml:"ContinuationToken,omitempty"`
+		NextContinuationToken string     `xml:"NextContinuationToken,omitempty"`
+		KeyCount              *int       `xml:"KeyCount"`
+		MaxKeys               int        `xml:"MaxKeys"`
+		IsTruncated           bool       `xml:"IsTruncated"`
+		Contents              []s3Object `xml:"Contents"`
+		CommonPrefixes        []s3Prefix `xml:"CommonPrefixes"`
+	}{
+		Xmlns:             s3Namespace,
+		Name:              bucket,
+		Prefix:            prefix,
+		Delimiter:         delimiter,
+		MaxKeys:           maxKeys,
+		StartAfter:        q.Get("start-after"),
+		ContinuationToken: q.Get("continuation-token"),
+	}
+	count, last := 0, ""
+	for _, it := range items {
+		key, isPrefix := it.key, it.file == nil
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				key, isPrefix = key[:len(prefix)+i+len(delimiter)], true
+			}
+		}
+		if key <= after || (isPrefix && key == last) {
+			continue
+		}
+		if count == maxKeys {
+			result.IsTruncated = true
+			break
+		}
+		if isPrefix {
+			result.CommonPrefixes = append(result.CommonPrefixes, s3Prefix{key})
+		} else {
+			result.Contents = append(result.Contents, s3Object{
+				Key:          key,
+				LastModified: it.file.ModifiedTime,
+				ETag:         `"` + it.file.Md5Checksum + `"`,
+				Size:         it.file.Size,
+				StorageClass: "STANDARD",
+			})
+		}
+		count++
+		last = key
+	}
+	if v2 {
+		result.KeyCount = &count
+		if result.IsTruncated {
+			result.NextContinuationToken = base64.URLEncoding.EncodeToString([]byte(last))
+		}
+	} else {
+		marker := q.Get("marker")
+		result.Marker = &marker
+		if result.IsTruncated && delimiter != "" {
+			result.NextMarker = last
+		}
+	}
+	return writeXML(w, http.StatusOK, &result)
+}
+
+func (g *s3Gateway) getObject(w http.ResponseWriter, r *http.Request, svc *drive.Service, bucket, key string) error {
+	driveId, err := getBucket(svc, bucket)
+	if err != nil {
+		return err
+	}
+	f, err := resolvePath(svc, driveId, key)
+	if errors.Is(err, errNotFound) || (err == nil && isFolder(f)) {
+		return errNoSuchKey
+	} else if err != nil {
+		return err
+	}
+	h := w.Header()
+	h.Set("Content-Type", f.MimeType)
+	h.Set("ETag", `"`+f.Md5Checksum+`"`)
+	h.Set("Accept-Ranges", "bytes")
+	if t, err := time.Parse(time.RFC3339, f.ModifiedTime); err == nil {
+		h.Set("Last-Modified", t.UTC().Format(http.TimeFormat))
+	}
+	if r.Method == http.MethodHead {
+		h.Set("Content-Length", strconv.FormatInt(f.Size, 10))
+		w.WriteHeader(http.StatusOK)
+		return nil
+	}
+	ranges := ""
+	if v := r.Header.Get("Range"); strings.HasPrefix(v, "bytes=") && !strings.Contains(v, ",") {
+		ranges = strings.TrimPrefix(v, "bytes=")
+	}
+	if blockCache != nil {
+		start, end, err := parseRange(ranges, f.Size)
+		if err != nil {
+			return &s3Error{Code: "InvalidRange", Message: "The requested range is not satisfiable", status: http.StatusRequestedRangeNotSatisfiable}
+		}
+		h.Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+		if ranges != "" {
+			h.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, f.Size))
+			w.WriteHeader(http.StatusPartialContent)
+		}
+		if err = cachedRead(w, svc, f, ranges); err != nil {
+			log.Println("Cached read error", f.Id, err)
+		}
+		return nil
+	}
+	res, err := download(svc, f.Id, ranges)
+	if err != nil {
+		var gerr *googleapi.Error
+		if errors.As(err, &gerr) && gerr.Code == http.StatusRequestedRangeNotSatisfiable {
+			return &s3Error{Code: "InvalidRange", Message: "The requested range is not satisfiable", status: gerr.Code}
+		}
+		return err
+	}
+	defer res.Body.Close()
+	for _, k := range []string{"Content-Length", "Content-Range"} {
+		if v := res.Header.Get(k); v != "" {
+			h.Set(k, v)
+		}
+	}
+	w.WriteHeader(res.StatusCode)
+	if _, err = io.Copy(w, res.Body); err != nil {
+		log.Println("Download error", f.Id, err)
+	}
+	return nil
+}
+
+func (g *s3Gateway) putObject(w http.ResponseWriter, r *http.Request, svc *drive.Service, bucket, key string) error {
+	driveId, err := getBucket(svc, bucket)
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(key, "/") {
+		if _, err = mkdirAll(svc, driveId, key); err != nil {
+			return err
+		}
+		w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+		w.WriteHeader(http.StatusOK)
+		return nil
+	}
+	tmp, _, err := spoolBody(r)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	f, err := uploadObject(svc, driveId, key, tmp)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("ETag", `"`+f.Md5Checksum+`"`)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// uploadObject creates or replaces the file at key, a folder of the same name is never replaced.
+func uploadObject(svc *drive.Service, driveId, key string, media io.Reader) (*drive.File, error) {
+	dir, name := path.Split(key)
+	parent, err := mkdirAll(svc, driveId, dir)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := findChild(svc, driveId, parent.Id, name)
+	if err != nil && !errors.Is(err, errNotFound) {
+		return nil, err
+	}
+	if existing != nil && isFolder(existing) {
+		return nil, errKeyIsFolder
+	}
+	f, err := replaceFile(svc, parent.Id, name, existing, media)
+	if errors.Is(err, errUploadMismatch) {
+		return nil, errBadUpload
+	}
+	return f, err
+}
+
+// deleteObject only trashes files, a key ending with / trashes its folder when it is empty.
+func (g *s3Gateway) deleteObject(w http.ResponseWriter, svc *drive.Service, bucket, key string) error {
+	driveId, err := getBucket(svc, bucket)
+	if err != nil {
+		return err
+	}
+	f, err := resolvePath(svc, driveId, key)
+	if err == nil && f.Id != driveId {
+		if !isFolder(f) {
+			if !strings.HasSuffix(key, "/") {
+				err = setTrashed(svc, f.Id, true)
+			}
+		} else if strings.HasSuffix(key, "/") {
+			var children []*drive.File
+			if children, err = listChildren(svc, driveId, f.Id); err == nil && len(children) == 0 {
+				err = setTrashed(svc, f.Id, true)
+			}
+		}
+	}
+	if err != nil && !errors.Is(err, errNotFound) {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (g *s3Gateway) createMultipartUpload(w http.ResponseWriter, svc *drive.Service, accessKey, bucket, key string) error {
+	driveId, err := getBucket(svc, bucket)
+	if err != nil {
+		return err
+	}
+	dir, err := ioutil.TempDir("", "gdc-s3-")
+	if err != nil {
+		return err
+	}
+	b := make([]byte, 16)
+	if _, err = rand.Read(b); err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+	id := hex.EncodeToString(b)
+	g.mu.Lock()
+	g.uploads[id] = &multipartUpload{driveId: driveId, key: key, dir: dir, owner: accessKey, created: time.Now()}
+	g.mu.Unlock()
+	return writeXML(w, http.StatusOK, &struct {
+		XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+		Xmlns    string   `xml:"xmlns,attr"`
+		Bucket   string   `xml:"Bucket"`
+		Key      string   `xml:"Key"`
+		UploadId string   `xml:"UploadId"`
+	}{Xmlns: s3Namespace, Bucket: bucket, Key: key, UploadId: id})
+}
+
+// upload returns the multipart upload, only to the access key that created it.
+func (g *s3Gateway) upload(accessKey, id string) (*multipartUpload, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	u, ok := g.uploads[id]
+	if !ok || u.owner != accessKey {
+		return nil, errNoSuchUpload
+	}
+	return u, nil
+}
+
+// expireUploads removes the parts of multipart uploads abandoned for longer than uploadExpiry.
+func (g *s3Gateway) expireUploads() {
+	for range time.Tick(time.Hour) {
+		g.mu.Lock()
+		for id, u := range g.uploads {
+			if time.Since(u.created) > uploadExpiry {
+				delete(g.uploads, id)
+				os.RemoveAll(u.dir)
+				log.Println("Expire multipart upload", id, u.key)
+			}
+		}
+		g.mu.Unlock()
+	}
+}
+
+func (g *s3Gateway) uploadPart(w http.ResponseWriter, r *http.Request, accessKey, id, partNumber string) error {
+	u, err := g.upload(accessKey, id)
+	if err != nil {
+		return err
+	}
+	n, err := strconv.Atoi(partNumber)
+	if err != nil || n < 1 || n > 10000 {
+		return &s3Error{Code: "InvalidArgument", Message: "invalid part number", status: http.StatusBadRequest}
+	}
+	tmp, sum, err := spoolBody(r)
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	if err = os.Rename(tmp.Name(), filepath.Join(u.dir, strconv.Itoa(n))); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	w.Header().Set("ETag", `"`+sum+`"`)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (g *s3Gateway) completeMultipartUpload(w http.ResponseWriter, r *http.Request, svc *drive.Service, accessKey, id string) error {
+	u, err := g.upload(accessKey, id)
+	if err != nil {
+		return err
+	}
+	var req struct {
+		Parts []struct {
+			PartNumber int    `xml:"PartNumber"`
+			ETag       string `xml:"ETag"`
+		} `xml:"Part"`
+	}
+	if err = xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &s3Error{Code: "MalformedXML", Message: err.Error(), status: http.StatusBadRequest}
+	}
+	var readers []io.Reader
+	for _, p := range req.Parts {
+		f, err := os.Open(filepath.Join(u.dir, strconv.Itoa(p.PartNumber)))
+		if err != nil {
+			return errInvalidPart
+		}
+		defer f.Close()
+		readers = append(readers, f)
+	}
+	f, err := uploadObject(svc, u.driveId, u.key, io.MultiReader(readers...))
+	if err != nil {
+		return err
+	}
+	g.mu.Lock()
+	delete(g.uploads, id)
+	g.mu.Unlock()
+	os.RemoveAll(u.dir)
+	return writeXML(w, http.StatusOK, &struct {
+		XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+		Xmlns   string   `xml:"xmlns,attr"`
+		Bucket  string   `xml:"Bucket"`
+		Key     string   `xml:"Key"`
+		ETag    string   `xml:"ETag"`
+	}{Xmlns: s3Namespace, Bucket: u.driveId, Key: u.key, ETag: `"` + f.Md5Checksum + `"`})
+}
+
+func (g *s3Gateway) abortMultipartUpload(w http.ResponseWriter, accessKey, id string) error {
+	u, err := g.upload(accessKey, id)
+	if err != nil {
+		return err
+	}
+	g.mu.Lock()
+	delete(g.uploads, id)
+	g.mu.Unlock()
+	os.RemoveAll(u.dir)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// spoolBody writes the request body to a temp file, returning its md5 and checking the signed payload hash.
+func spoolBody(r *http.Request) (*os.File, string, error) {
+	tmp, err := ioutil.TempFile("", "gdc-s3-")
+	if err != nil {
+		return nil, "", err
+	}
+	md5sum, sha := md5.New(), sha256.New()
+	if _, err = io.Copy(io.MultiWriter(tmp, md5sum, sha), r.Body); err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err == nil {
+		if h := r.Header.Get("X-Amz-Content-Sha256"); h != "" && h != unsignedPayload && h != hex.EncodeToString(sha.Sum(nil)) {
+			err = errBadDigest
+		} else if h := r.Header.Get("Content-Md5"); h != "" && h != base64.StdEncoding.EncodeToString(md5sum.Sum(nil)) {
+			err = errContentMD5
+		}
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, "", err
+	}
+	return tmp, hex.EncodeToString(md5sum.Sum(nil)), nil
+}
+
+// authenticate verifies the AWS signature v4 Authorization header and returns the key's drive service and id.
+func (g *s3Gateway) authenticate(r *http.Request) (*drive.Service, string, error) {
+	if g.insecure {
+		return service, "", nil
+	}
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 ") {
+		return nil, "", errAccessDenied
+	}
+	params := make(map[string]string)
+	for _, kv := range strings.Split(strings.TrimPrefix(auth, "AWS4-HMAC-SHA256 "), ",") {
+		if i := strings.Index(kv, "="); i != -1 {
+			params[strings.TrimSpace(kv[:i])] = strings.TrimSpace(kv[i+1:])
+		}
+	}
+	cred := strings.Split(params["Credential"], "/")
+	if len(cred) != 5 {
+		return nil, "", errAccessDenied
+	}
+	key, ok := g.keys[cred[0]]
+	if !ok {
+		return nil, "", &s3Error{Code: "InvalidAccessKeyId", Message: "The access key Id you provided does not exist", status: http.StatusForbidden}
+	}
+	if err := checkRequestTime(r.Header.Get("X-Amz-Date"), s3Now()); err != nil {
+		return nil, "", err
+	}
+	payload := r.Header.Get("X-Amz-Content-Sha256")
+	if payload == "" {
+		payload = unsignedPayload
+	}
+	if strings.HasPrefix(payload, "STREAMING-") {
+		return nil, "", errNotImplemented
+	}
+
+	signed := strings.Split(params["SignedHeaders"], ";")
+	var headers strings.Builder
+	for _, name := range signed {
+		v := r.Header.Get(name)
+		if name == "host" {
+			v = r.Host
+		} else if name == "content-length" {
+			v = strconv.FormatInt(r.ContentLength, 10)
+		}
+		headers.WriteString(name + ":" + strings.Join(strings.Fields(v), " ") + "\n")
+	}
+	canonical := strings.Join([]string{
+		r.Method,
+		awsEscape(r.URL.Path, false),
+		canonicalQuery(r.URL.Query()),
+		headers.String(),
+		params["SignedHeaders"],
+		payload,
+	}, "\n")
+	scope := strings.Join(cred[1:], "/")
+	sum := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + r.Header.Get("X-Amz-Date") + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	k := []byte("AWS4" + key.Secret)
+	for _, s := range cred[1:] {
+		k = hmacSum(k, s)
+	}
+	if !hmac.Equal([]byte(hex.EncodeToString(hmacSum(k, toSign))), []byte(params["Signature"])) {
+		return nil, "", errSignature
+	}
+	return g.services[cred[0]], cred[0], nil
+}
+
+// maxRequestSkew bounds the replay window of a signed request, like S3 does.
+const maxRequestSkew = 15 * time.Minute
+
+var s3Now = time.Now
+
+func checkRequestTime(amzDate string, now time.Time) error {
+	t, err := time.Parse("20060102T150405Z", amzDate)
+	if err != nil {
+		return errAccessDenied
+	}
+	if d := now.Sub(t); d > maxRequestSkew || d < -maxRequestSkew {
+		return errTimeSkewed
+	}
+	return nil
+}
+
+func hmacSum(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func canonicalQuery(q url.Values) string {
+	var pairs []string
+	for k, vs := range q {
+		for _, v := range vs {
+			pairs = append(pairs, awsEscape(k, true)+"="+awsEscape(v, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// awsEscape percent-encodes everything except the unreserved characters (and '/' in paths).
+func awsEscape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+var buckets sync.Map
+
+func getBucket(svc *drive.Service, bucket string) (string, error) {
+	if _, ok := buckets.Load(bucket); ok {
+		return bucket, nil
+	}
+	d, err := svc.Drives.Get(bucket).Fields("id").Do()
+	if err != nil {
+		var gerr *googleapi.Error
+		if errors.As(err, &gerr) && gerr.Code == http.StatusNotFound {
+			return "", errNoSuchBucket
+		}
+		return "", err
+	}
+	buckets.Store(d.Id, true)
+	return d.Id, nil
+}
+
+func splitBucketKey(p string) (string, string) {
+	p = strings.TrimPrefix(p, "/")
+	if i := strings.Index(p, "/"); i != -1 {
+		return p[:i], p[i+1:]
+	}
+	return p, ""
+}
+
+func writeXML(w http.ResponseWriter, status int, v interface{}) error {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	io.WriteString(w, xml.Header)
+	return xml.NewEncoder(w).Encode(v)
+}
+
+func writeS3Error(w http.ResponseWriter, err error) {
+	var serr *s3Error
+	var gerr *googleapi.Error
+	if !errors.As(err, &serr) {
+		serr = &s3Error{Code: "InternalError", Message: err.Error(), status: http.StatusInternalServerError}
+		if errors.As(err, &gerr) {
+			serr.status = gerr.Code
+			if gerr.Code == http.StatusForbidden {
+				serr.Code = "AccessDenied"
+			}
+		}
+	}
+	log.Println("S3 error:", serr)
+	writeXML(w, serr.status, serr)
+}
@@ -4,8 +4,10 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"github.com/lnzx/gdc/internal/sa"
 	"google.golang.org/api/drive/v3"
 	"google.golang.org/api/option"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
@@ -46,12 +48,12 @@ func initSync() {
 	if !f.IsDir() {
 		log.Fatal("sa not a folder.")
 	}
-	fs, err := ioutil.ReadDir(dir)
+	keys, err := sa.Keys(dir)
 	if err != nil {
 		log.Fatal(err)
 	}
-	for _, x := range fs {
-		path := dir + "/" + x.Name()
+	for _, key := range keys {
+		path := key
 		sas = append(sas, &path)
 	}
 	l := len(sas)
@@ -73,8 +75,16 @@ func next() *string {
 	return sa
 }
 
-func Sync(dir, driveId string, t time.Duration, parentId string) {
+func Sync(dir, dest string, t time.Duration, parentId string, headSize int64, manifest string) {
 	initSync()
+	driveId, err := resolveDest(service, dest)
+	if err != nil {
+		log.Fatalln("Error: resolve destination", err)
+	}
+	heads = &headManifest{path: manifest, size: headSize}
+	if err = heads.load(); err != nil {
+		log.Fatalln("Error: load head manifest", err)
+	}
 
 	defer func() {
 		if err := recover(); err != nil {
@@ -136,12 +146,16 @@ func uploadTask(dir, filename, driveId string, parentId string) {
 		return
 	}
 
-	head := make([]byte, kib64)
-	_, err = media.Read(head)
-	if err != nil {
+	defer media.Close()
+
+	head := make([]byte, heads.size)
+	n, err := media.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		log.Println("Read head err", err)
 		return
 	}
-	uploadHead(head, filename, parentId)
+	// the body is uploaded anyway, heads restore rebuilds the missing head from it
+	headId, _ := uploadHead(headSvc, head[:n], filename, parentId)
 
 	sa := next()
 	log.Println("use sa: ", *sa)
@@ -151,10 +165,10 @@ func uploadTask(dir, filename, driveId string, parentId string) {
 		return
 	}
 	reader := bufio.NewReaderSize(media, uploadChunkSize)
-	_, err = svc.Files.Create(&drive.File{
+	body, err := svc.Files.Create(&drive.File{
 		Name:    filename,
 		Parents: []string{driveId},
-	}).SupportsAllDrives(true).Fields().Media(reader).Do()
+	}).SupportsAllDrives(true).Fields("id", "size").Media(reader).Do()
 	if err != nil {
 		log.Println("Upload err", err)
 		return
@@ -162,22 +176,34 @@ func uploadTask(dir, filename, driveId string, parentId string) {
 	media.Close()
 	log.Printf("<--Upload body [OK]: %s\n", filename)
 
+	heads.put(filename, &headEntry{
+		HeadId:   headId,
+		BodyId:   body.Id,
+		HeadSize: int64(n),
+		Size:     body.Size,
+		Full:     true,
+	})
+	if err = heads.save(); err != nil {
+		log.Println("Save head manifest err", err)
+	}
+
 	if err = os.Remove(filepath); err != nil {
 		log.Printf("<--Remove [ERROR]: %s\n", media.Name())
 	}
 }
 
-func uploadHead(head []byte, filename string, parentId string) {
+func uploadHead(svc *drive.Service, head []byte, filename string, parentId string) (string, error) {
 	reader := bytes.NewReader(head)
-	_, err := headSvc.Files.Create(&drive.File{
+	f, err := svc.Files.Create(&drive.File{
 		Name:    filename,
 		Parents: []string{parentId},
-	}).Fields().Media(reader).Do()
+	}).Fields("id").Media(reader).Do()
 	if err != nil {
 		log.Println("Upload head err", err)
-		return
+		return "", err
 	}
 	log.Printf("<--Upload head [OK]: %s\n", filename)
+	return f.Id, nil
 }
 
 func mixFilename(filename string) string {
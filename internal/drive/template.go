@@ -0,0 +1,159 @@
+package drive
+
+import (
+	"fmt"
+	"google.golang.org/api/drive/v3"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// DriveSpec declares a set of drives, name may contain {n} which is replaced by 1 .. count.
+type DriveSpec struct {
+	Name         string            `yaml:"name"`
+	Count        int               `yaml:"count"`
+	Hidden       *bool             `yaml:"hidden"`
+	Restrictions *RestrictionsSpec `yaml:"restrictions"`
+	Permissions  []PermissionSpec  `yaml:"permissions"`
+	Folders      []string          `yaml:"folders"`
+}
+
+type RestrictionsSpec struct {
+	DomainUsersOnly          *bool `yaml:"domainUsersOnly"`
+	CopyRequiresWriter       *bool `yaml:"copyRequiresWriter"`
+	AdminManagedRestrictions *bool `yaml:"adminManagedRestrictions"`
+}
+
+// PermissionSpec is a user, group, domain or anyone permission, email holds the domain for domain permissions.
+type PermissionSpec struct {
+	Type  string `yaml:"type"`
+	Email string `yaml:"email"`
+	Role  string `yaml:"role"`
+}
+
+type driveSpecs struct {
+	Drives []DriveSpec `yaml:"drives"`
+}
+
+// names expands the spec into drive names, without {n} the names are suffixed like mb -c.
+func (s *DriveSpec) names() []string {
+	if s.Count <= 1 {
+		return []string{strings.ReplaceAll(s.Name, "{n}", "1")}
+	}
+	var names []string
+	for i := 1; i <= s.Count; i++ {
+		n := strconv.Itoa(i)
+		if strings.Contains(s.Name, "{n}") {
+			names = append(names, strings.ReplaceAll(s.Name, "{n}", n))
+		} else {
+			names = append(names, s.Name+"-"+n)
+		}
+	}
+	return names
+}
+
+// ApplySpec reconciles the shared drives with the yaml spec: missing drives and folders are created,
+// permissions are added or updated and restrictions changed. Nothing is deleted.
+func ApplySpec(file string, requestsFile string) error {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var specs driveSpecs
+	if err = yaml.Unmarshal(b, &specs); err != nil {
+		return fmt.Errorf("parse %s: %v", file, err)
+	}
+	for _, spec := range specs.Drives {
+		if spec.Name == "" {
+			return fmt.Errorf("drive spec without name")
+		}
+		for _, p := range spec.Permissions {
+			if _, err = p.change(); err != nil {
+				return err
+			}
+		}
+	}
+
+	drives, err := allDrives(false)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]*drive.Drive)
+	for _, d := range drives {
+		existing[d.Name] = d
+	}
+	requests, err := loadRequests(requestsFile)
+	if err != nil {
+		return err
+	}
+	for _, spec := range specs.Drives {
+		var adds []*PermChange
+		for _, p := range spec.Permissions {
+			c, _ := p.change()
+			adds = append(adds, c)
+		}
+		for _, name := range spec.names() {
+			d, ok := existing[name]
+			if !ok {
+				if d, err = createDrive(name, requests, requestsFile); err != nil {
+					fmt.Println("create drive error", name, err)
+					continue
+				}
+				fmt.Printf("Create drive id: %s name: %s [OK]\n", d.Id, name)
+			} else {
+				fmt.Printf("Drive exists id: %s name: %s\n", d.Id, name)
+			}
+			if err = reconcileDrive(d, &spec, adds); err != nil {
+				fmt.Println("apply drive error", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func reconcileDrive(d *drive.Drive, spec *DriveSpec, adds []*PermChange) error {
+	for _, r := range applyDrivePermissions(d, adds, nil, false) {
+		if r.result != "unchanged" {
+			fmt.Printf("  permission %s %s\n", r.change, r.result)
+		}
+	}
+
+	u := DriveUpdate{}
+	current := d.Restrictions
+	if current == nil {
+		current = &drive.DriveRestrictions{}
+	}
+	if r := spec.Restrictions; r != nil {
+		if r.DomainUsersOnly != nil && *r.DomainUsersOnly != current.DomainUsersOnly {
+			u.DomainUsersOnly = r.DomainUsersOnly
+		}
+		if r.CopyRequiresWriter != nil && *r.CopyRequiresWriter != current.CopyRequiresWriterPermission {
+			u.CopyRequiresWriter = r.CopyRequiresWriter
+		}
+		if r.AdminManagedRestrictions != nil && *r.AdminManagedRestrictions != current.AdminManagedRestrictions {
+			u.AdminManagedRestrictions = r.AdminManagedRestrictions
+		}
+	}
+	if spec.Hidden != nil && *spec.Hidden != d.Hidden {
+		u.Hidden = spec.Hidden
+	}
+	if err := UpdateDrive(d.Id, u, false); err != nil {
+		return err
+	}
+
+	for _, folder := range spec.Folders {
+		if _, err := mkdirAll(service, d.Id, folder); err != nil {
+			return fmt.Errorf("folder %s: %v", folder, err)
+		}
+	}
+	return nil
+}
+
+func (p *PermissionSpec) change() (*PermChange, error) {
+	s := p.Type
+	if p.Email != "" {
+		s += ":" + p.Email
+	}
+	return ParsePermChange(s+":"+p.Role, true)
+}
@@ -0,0 +1,25 @@
+package drive
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDriveSpecNames(t *testing.T) {
+	tests := []struct {
+		spec DriveSpec
+		want []string
+	}{
+		{spec: DriveSpec{Name: "plots"}, want: []string{"plots"}},
+		{spec: DriveSpec{Name: "plots", Count: 1}, want: []string{"plots"}},
+		{spec: DriveSpec{Name: "plots-{n}"}, want: []string{"plots-1"}},
+		{spec: DriveSpec{Name: "plots", Count: 3}, want: []string{"plots-1", "plots-2", "plots-3"}},
+		{spec: DriveSpec{Name: "k32-{n}-plots", Count: 2}, want: []string{"k32-1-plots", "k32-2-plots"}},
+		{spec: DriveSpec{Name: "{n}-{n}", Count: 2}, want: []string{"1-1", "2-2"}},
+	}
+	for _, tt := range tests {
+		if got := tt.spec.names(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("names(%q, %d) = %v, want %v", tt.spec.Name, tt.spec.Count, got, tt.want)
+		}
+	}
+}
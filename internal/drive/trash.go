@@ -0,0 +1,110 @@
+package drive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+	"net/http"
+)
+
+// Remove moves the files to the trash, with permanent they are deleted for good.
+func Remove(fileIds []string, permanent bool) {
+	for i, id := range fileIds {
+		if permanent {
+			if err := service.Files.Delete(id).SupportsAllDrives(true).Fields().Do(); err != nil {
+				fmt.Println(err)
+			} else {
+				fmt.Printf("%d Delete file: %s [OK]\n", i, id)
+			}
+			continue
+		}
+		if err := setTrashed(service, id, true); err != nil {
+			fmt.Println(err)
+		} else {
+			fmt.Printf("%d Trash file: %s [OK]\n", i, id)
+		}
+	}
+}
+
+// ListTrash lists the trashed files of a shared drive, or of My Drive when driveId is empty.
+func ListTrash(driveId string) {
+	files, err := trashedFiles(driveId)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for i, f := range files {
+		fmt.Printf("%d id: %s name: %s size: %d\n", i, f.Id, f.Name, f.Size)
+	}
+}
+
+// RestoreTrash takes the files out of the trash.
+func RestoreTrash(fileIds []string) {
+	for i, id := range fileIds {
+		if err := setTrashed(service, id, false); err != nil {
+			fmt.Println(err)
+		} else {
+			fmt.Printf("%d Restore file: %s [OK]\n", i, id)
+		}
+	}
+}
+
+// EmptyTrash permanently deletes every trashed file of a shared drive, or of My Drive when driveId is empty.
+func EmptyTrash(driveId string) error {
+	if driveId == "" {
+		if err := service.Files.EmptyTrash().Do(); err != nil {
+			return err
+		}
+		fmt.Println("Empty trash [OK]")
+		return nil
+	}
+	// Files.EmptyTrash only covers My Drive, shared drive items are deleted one by one
+	files, err := trashedFiles(driveId)
+	if err != nil {
+		return err
+	}
+	deleted, failed := 0, 0
+	for _, f := range files {
+		err := service.Files.Delete(f.Id).SupportsAllDrives(true).Fields().Do()
+		var gerr *googleapi.Error
+		if errors.As(err, &gerr) && gerr.Code == http.StatusNotFound {
+			// already gone with its trashed parent folder
+			err = nil
+		}
+		if err != nil {
+			failed++
+			fmt.Println("Delete file", f.Id, err)
+			continue
+		}
+		deleted++
+	}
+	fmt.Printf("Empty trash %s deleted: %d failed: %d\n", driveId, deleted, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d files failed", failed)
+	}
+	return nil
+}
+
+func setTrashed(svc *drive.Service, fileId string, trashed bool) error {
+	_, err := svc.Files.Update(fileId, &drive.File{
+		Trashed:         trashed,
+		ForceSendFields: []string{"Trashed"},
+	}).SupportsAllDrives(true).Fields("id").Do()
+	return err
+}
+
+func trashedFiles(driveId string) ([]*drive.File, error) {
+	var files []*drive.File
+	call := service.Files.List().Q("trashed=true").PageSize(1000).
+		Fields("nextPageToken", "files("+fileFields+")")
+	if driveId != "" {
+		call.SupportsAllDrives(true).IncludeItemsFromAllDrives(true).Corpora("drive").DriveId(driveId)
+	}
+	err := call.Pages(context.Background(), func(list *drive.FileList) error {
+		files = append(files, list.Files...)
+		return nil
+	})
+	return files, err
+}
@@ -0,0 +1,246 @@
+package drive
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+type uploadJob struct {
+	path     string
+	name     string
+	parentId string
+	existing *drive.File
+	// modTime is kept as the remote modified time when set
+	modTime string
+	// checked skips the size/md5 comparison, the caller already decided to upload
+	checked bool
+}
+
+// CopyDir uploads the local tree into dest (drive:/path), like cp a trailing slash copies the
+// contents of localDir instead of the folder itself. Files with the same size and md5 are skipped,
+// with move each local file is removed once its upload is verified. A regular file is handed to Copy or Move.
+func CopyDir(localDir string, dest string, concurrency int, move bool) error {
+	stat, err := os.Stat(localDir)
+	if err != nil {
+		return err
+	}
+	if !stat.IsDir() {
+		if move {
+			return Move(localDir, dest)
+		}
+		return Copy(localDir, dest)
+	}
+	driveId, path := parseRemote(dest)
+	if !strings.HasSuffix(localDir, "/") {
+		path += "/" + filepath.Base(localDir)
+	}
+	root, err := mkdirAll(service, driveId, path)
+	if err != nil {
+		return err
+	}
+	jobs, wait := startUploads(concurrency, move)
+
+	folders := map[string]*drive.File{".": root}
+	walkErr := filepath.Walk(localDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(localDir, p)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if rel == "." {
+				return nil
+			}
+			parent := folders[filepath.Dir(rel)]
+			folder, err := childFolder(driveId, parent.Id, info.Name())
+			if err != nil {
+				return err
+			}
+			folders[rel] = folder
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		parent := folders[filepath.Dir(rel)]
+		existing, err := findChild(service, driveId, parent.Id, info.Name())
+		if err != nil && !errors.Is(err, errNotFound) {
+			return err
+		}
+		jobs <- &uploadJob{path: p, name: info.Name(), parentId: parent.Id, existing: existing}
+		return nil
+	})
+	close(jobs)
+	failed := wait()
+	if walkErr != nil {
+		return walkErr
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d files failed", failed)
+	}
+	return nil
+}
+
+// startUploads runs the upload workers, close the channel and call wait for the summary and the number of failures.
+func startUploads(concurrency int, move bool) (chan<- *uploadJob, func() int) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	jobs := make(chan *uploadJob)
+	var mu sync.Mutex
+	var uploaded, skipped, failed int
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				ok, err := uploadFile(job, move)
+				mu.Lock()
+				switch {
+				case err != nil:
+					failed++
+					fmt.Println("Upload file err", job.path, err)
+				case ok:
+					uploaded++
+				default:
+					skipped++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	return jobs, func() int {
+		wg.Wait()
+		fmt.Printf("uploaded: %d skipped: %d failed: %d\n", uploaded, skipped, failed)
+		return failed
+	}
+}
+
+func childFolder(driveId, parentId, name string) (*drive.File, error) {
+	f, err := findChild(service, driveId, parentId, name)
+	if errors.Is(err, errNotFound) {
+		return service.Files.Create(&drive.File{
+			Name:     name,
+			MimeType: folderMimeType,
+			Parents:  []string{parentId},
+		}).SupportsAllDrives(true).Fields(fileFields).Do()
+	} else if err != nil {
+		return nil, err
+	}
+	if !isFolder(f) {
+		return nil, fmt.Errorf("not a folder: %s", name)
+	}
+	return f, nil
+}
+
+// uploadFile uploads the job unless an identical file exists, it returns false when skipped.
+func uploadFile(job *uploadJob, move bool) (bool, error) {
+	media, err := os.Open(job.path)
+	if err != nil {
+		return false, err
+	}
+	defer media.Close()
+	stat, err := media.Stat()
+	if err != nil {
+		return false, err
+	}
+	if e := job.existing; e != nil && !job.checked && e.Size == stat.Size() {
+		sum, err := fileMd5(job.path)
+		if err != nil {
+			return false, err
+		}
+		if sum == e.Md5Checksum {
+			fmt.Printf("Skip file: %s [SAME]\n", job.path)
+			return false, removeVerified(job.path, move)
+		}
+	}
+
+	hash := md5.New()
+	reader := io.TeeReader(bufio.NewReaderSize(media, uploadChunkSize), hash)
+	var f *drive.File
+	if job.existing != nil {
+		f, err = service.Files.Update(job.existing.Id, &drive.File{ModifiedTime: job.modTime}).
+			SupportsAllDrives(true).Fields("id", "md5Checksum").Media(reader).Do()
+	} else {
+		f, err = service.Files.Create(&drive.File{
+			Name:         job.name,
+			Parents:      []string{job.parentId},
+			ModifiedTime: job.modTime,
+		}).SupportsAllDrives(true).Fields("id", "md5Checksum").Media(reader).Do()
+	}
+	if err != nil {
+		return false, err
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != f.Md5Checksum {
+		return false, fmt.Errorf("md5 mismatch local: %s remote: %s", sum, f.Md5Checksum)
+	}
+	fmt.Printf("Upload file id: %s name: %s [OK]\n", f.Id, job.path)
+	return true, removeVerified(job.path, move)
+}
+
+func removeVerified(path string, move bool) error {
+	if !move {
+		return nil
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	fmt.Println("remove local file", path)
+	return nil
+}
+
+func fileMd5(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := md5.New()
+	if _, err = io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+var errUploadMismatch = errors.New("uploaded content md5 mismatch")
+
+// replaceFile uploads media as a new file next to existing, which is only trashed once the md5 of
+// the upload matches. A mismatching upload is deleted and errUploadMismatch returned.
+func replaceFile(svc *drive.Service, parentId, name string, existing *drive.File, media io.Reader) (*drive.File, error) {
+	hash := md5.New()
+	f, err := svc.Files.Create(&drive.File{
+		Name:    name,
+		Parents: []string{parentId},
+	}).SupportsAllDrives(true).Fields("id", "md5Checksum").
+		Media(io.TeeReader(media, hash), googleapi.ChunkSize(uploadChunkSize)).Do()
+	if err != nil {
+		return nil, err
+	}
+	if f.Md5Checksum != hex.EncodeToString(hash.Sum(nil)) {
+		// the broken upload is ours, it is dropped for good
+		if err = svc.Files.Delete(f.Id).SupportsAllDrives(true).Do(); err != nil {
+			log.Println("Delete bad upload error", f.Id, err)
+		}
+		return nil, errUploadMismatch
+	}
+	if existing != nil {
+		if err = setTrashed(svc, existing.Id, true); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
@@ -0,0 +1,483 @@
+package drive
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"golang.org/x/net/webdav"
+	"google.golang.org/api/drive/v3"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// statTTL is how long resolved paths are reused, PROPFIND stats every entry it lists.
+const statTTL = 5 * time.Second
+
+type davFS struct {
+	svc     *drive.Service
+	driveId string
+
+	mu    sync.Mutex
+	stats map[string]*statEntry
+}
+
+type statEntry struct {
+	file   *drive.File
+	expiry time.Time
+}
+
+// contentLengthKey holds the Content-Length of a PUT in the request context.
+type contentLengthKey struct{}
+
+// davAuth checks basic auth against the users file and passes the PUT length on to davWriter.
+type davAuth struct {
+	users map[string]string
+	next  http.Handler
+}
+
+func (a *davAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if a.users != nil {
+		user, pass, ok := r.BasicAuth()
+		want, found := a.users[user]
+		if !ok || !found || subtle.ConstantTimeCompare([]byte(pass), []byte(want)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="gdc"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+	if r.Method == http.MethodPut {
+		r = r.WithContext(context.WithValue(r.Context(), contentLengthKey{}, r.ContentLength))
+	}
+	a.next.ServeHTTP(w, r)
+}
+
+// loadUsers reads user:password lines, empty lines and lines starting with # are skipped.
+func loadUsers(file string) (map[string]string, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	users := make(map[string]string)
+	for i, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		n := strings.Index(line, ":")
+		if n < 1 || n == len(line)-1 {
+			return nil, fmt.Errorf("%s:%d: expected user:password", file, i+1)
+		}
+		users[line[:n]] = line[n+1:]
+	}
+	if len(users) == 0 {
+		return nil, fmt.Errorf("%s: no users", file)
+	}
+	return users, nil
+}
+
+// ServeWebDAV maps webdav requests onto the files of the shared drive.
+// usersFile holds the basic auth user:password lines, it is required unless insecure is set.
+func ServeWebDAV(addr string, driveId string, usersFile string, insecure bool) error {
+	if usersFile == "" && !insecure {
+		return fmt.Errorf("a users file is required, use --insecure to serve without authentication")
+	}
+	auth := &davAuth{}
+	if usersFile != "" {
+		users, err := loadUsers(usersFile)
+		if err != nil {
+			return err
+		}
+		auth.users = users
+	}
+	log.Println("Serve webdav:", addr, "drive:", driveId, "users:", len(auth.users))
+	auth.next = &webdav.Handler{
+		FileSystem: &davFS{svc: service, driveId: driveId, stats: make(map[string]*statEntry)},
+		LockSystem: webdav.NewMemLS(),
+		Logger: func(r *http.Request, err error) {
+			if err != nil {
+				log.Println(r.Method, r.URL.Path, err)
+			} else {
+				log.Println(r.Method, r.URL.Path)
+			}
+		},
+	}
+	return http.ListenAndServe(addr, auth)
+}
+
+func (fs *davFS) resolve(name string) (*drive.File, error) {
+	name = path.Clean("/" + name)
+	fs.mu.Lock()
+	e, ok := fs.stats[name]
+	fs.mu.Unlock()
+	if ok && time.Now().Before(e.expiry) {
+		return e.file, nil
+	}
+	f, err := resolvePath(fs.svc, fs.driveId, name)
+	if errors.Is(err, errNotFound) {
+		return nil, os.ErrNotExist
+	} else if err != nil {
+		return nil, err
+	}
+	fs.remember(name, f)
+	return f, nil
+}
+
+func (fs *davFS) remember(name string, f *drive.File) {
+	fs.mu.Lock()
+	fs.stats[name] = &statEntry{file: f, expiry: time.Now().Add(statTTL)}
+	fs.mu.Unlock()
+}
+
+func (fs *davFS) forget() {
+	fs.mu.Lock()
+	fs.stats = make(map[string]*statEntry)
+	fs.mu.Unlock()
+}
+
+func (fs *davFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	dir, base := path.Split(path.Clean("/" + name))
+	if base == "" {
+		return os.ErrExist
+	}
+	parent, err := fs.resolve(dir)
+	if err != nil {
+		return err
+	}
+	if _, err = findChild(fs.svc, fs.driveId, parent.Id, base); err == nil {
+		return os.ErrExist
+	} else if !errors.Is(err, errNotFound) {
+		return err
+	}
+	_, err = fs.svc.Files.Create(&drive.File{
+		Name:     base,
+		MimeType: folderMimeType,
+		Parents:  []string{parent.Id},
+	}).SupportsAllDrives(true).Fields("id").Context(ctx).Do()
+	fs.forget()
+	return err
+}
+
+func (fs *davFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	name = path.Clean("/" + name)
+	f, err := fs.resolve(name)
+	write := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	if os.IsNotExist(err) && flag&os.O_CREATE != 0 {
+		dir, base := path.Split(name)
+		parent, err := fs.resolve(dir)
+		if err != nil {
+			return nil, err
+		}
+		f = &drive.File{Name: base, Parents: []string{parent.Id}, ModifiedTime: time.Now().Format(time.RFC3339)}
+		return newDavWriter(ctx, fs, f)
+	} else if err != nil {
+		return nil, err
+	}
+	if flag&os.O_EXCL != 0 && flag&os.O_CREATE != 0 {
+		return nil, os.ErrExist
+	}
+	if isFolder(f) {
+		if write {
+			return nil, os.ErrPermission
+		}
+		return &davFile{fs: fs, name: name, file: f}, nil
+	}
+	if write {
+		return newDavWriter(ctx, fs, f)
+	}
+	return &davFile{fs: fs, name: name, file: f}, nil
+}
+
+func (fs *davFS) RemoveAll(ctx context.Context, name string) error {
+	f, err := fs.resolve(name)
+	if err != nil {
+		return err
+	}
+	if f.Id == fs.driveId {
+		return os.ErrPermission
+	}
+	err = setTrashed(fs.svc, f.Id, true)
+	fs.forget()
+	return err
+}
+
+func (fs *davFS) Rename(ctx context.Context, oldName, newName string) error {
+	f, err := fs.resolve(oldName)
+	if err != nil {
+		return err
+	}
+	if f.Id == fs.driveId {
+		return os.ErrPermission
+	}
+	dir, base := path.Split(path.Clean("/" + newName))
+	parent, err := fs.resolve(dir)
+	if err != nil {
+		return err
+	}
+	call := fs.svc.Files.Update(f.Id, &drive.File{Name: base}).SupportsAllDrives(true).Fields("id")
+	if len(f.Parents) > 0 && f.Parents[0] != parent.Id {
+		call.AddParents(parent.Id).RemoveParents(f.Parents[0])
+	}
+	_, err = call.Context(ctx).Do()
+	fs.forget()
+	return err
+}
+
+func (fs *davFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	f, err := fs.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return &fileInfo{f}, nil
+}
+
+// davFile reads a drive file with ranged downloads, the stream is reopened after a seek.
+type davFile struct {
+	fs   *davFS
+	name string
+	file *drive.File
+
+	off  int64
+	body io.ReadCloser
+	dirs []os.FileInfo
+	read bool
+}
+
+func (f *davFile) Read(p []byte) (int, error) {
+	if isFolder(f.file) {
+		return 0, os.ErrInvalid
+	}
+	if f.off >= f.file.Size {
+		return 0, io.EOF
+	}
+	if blockCache != nil && len(p) > 0 {
+		var buf bytes.Buffer
+		if err := cachedRead(&buf, f.fs.svc, f.file, fmt.Sprintf("%d-%d", f.off, f.off+int64(len(p))-1)); err != nil {
+			return 0, err
+		}
+		n := copy(p, buf.Bytes())
+		f.off += int64(n)
+		return n, nil
+	}
+	if f.body == nil {
+		res, err := download(f.fs.svc, f.file.Id, formatOffset(f.off))
+		if err != nil {
+			return 0, err
+		}
+		f.body = res.Body
+	}
+	n, err := f.body.Read(p)
+	f.off += int64(n)
+	return n, err
+}
+
+func (f *davFile) Seek(offset int64, whence int) (int64, error) {
+	off := offset
+	switch whence {
+	case io.SeekCurrent:
+		off += f.off
+	case io.SeekEnd:
+		off += f.file.Size
+	}
+	if off < 0 {
+		return 0, os.ErrInvalid
+	}
+	if off != f.off && f.body != nil {
+		f.body.Close()
+		f.body = nil
+	}
+	f.off = off
+	return off, nil
+}
+
+func (f *davFile) Readdir(count int) ([]os.FileInfo, error) {
+	if !isFolder(f.file) {
+		return nil, os.ErrInvalid
+	}
+	if !f.read {
+		files, err := listChildren(f.fs.svc, f.fs.driveId, f.file.Id)
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range files {
+			f.fs.remember(path.Join(f.name, child.Name), child)
+			f.dirs = append(f.dirs, &fileInfo{child})
+		}
+		f.read = true
+	}
+	if count <= 0 {
+		dirs := f.dirs
+		f.dirs = nil
+		return dirs, nil
+	}
+	if len(f.dirs) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(f.dirs) {
+		count = len(f.dirs)
+	}
+	dirs := f.dirs[:count]
+	f.dirs = f.dirs[count:]
+	return dirs, nil
+}
+
+func (f *davFile) Stat() (os.FileInfo, error) {
+	return &fileInfo{f.file}, nil
+}
+
+func (f *davFile) Write(p []byte) (int, error) {
+	return 0, os.ErrPermission
+}
+
+func (f *davFile) Close() error {
+	if f.body != nil {
+		return f.body.Close()
+	}
+	return nil
+}
+
+// davWriter spools the content to a temp file and uploads it on close.
+type davWriter struct {
+	// ctx is the request context, the upload is dropped when the request was aborted
+	ctx  context.Context
+	fs   *davFS
+	file *drive.File
+	tmp  *os.File
+	err  error
+}
+
+func newDavWriter(ctx context.Context, fs *davFS, f *drive.File) (*davWriter, error) {
+	tmp, err := ioutil.TempFile("", "gdc-dav-")
+	if err != nil {
+		return nil, err
+	}
+	return &davWriter{ctx: ctx, fs: fs, file: f, tmp: tmp}, nil
+}
+
+func (w *davWriter) Write(p []byte) (int, error) {
+	n, err := w.tmp.Write(p)
+	if err != nil {
+		w.err = err
+	}
+	return n, err
+}
+
+func (w *davWriter) Read(p []byte) (int, error) {
+	return w.tmp.Read(p)
+}
+
+func (w *davWriter) Seek(offset int64, whence int) (int64, error) {
+	return w.tmp.Seek(offset, whence)
+}
+
+func (w *davWriter) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, os.ErrInvalid
+}
+
+func (w *davWriter) Stat() (os.FileInfo, error) {
+	f := *w.file
+	if stat, err := w.tmp.Stat(); err == nil {
+		f.Size = stat.Size()
+	}
+	return &fileInfo{&f}, nil
+}
+
+// Close uploads the spooled content unless the PUT was aborted or is short, the webdav handler
+// closes the file even when copying the body failed. An existing file is only replaced once
+// the new content is uploaded and verified.
+func (w *davWriter) Close() error {
+	defer os.Remove(w.tmp.Name())
+	defer w.tmp.Close()
+	if w.err != nil {
+		return w.err
+	}
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+	stat, err := w.tmp.Stat()
+	if err != nil {
+		return err
+	}
+	if n, ok := w.ctx.Value(contentLengthKey{}).(int64); ok && n >= 0 && stat.Size() != n {
+		return fmt.Errorf("incomplete upload of %s: %d of %d bytes", w.file.Name, stat.Size(), n)
+	}
+	if _, err = w.tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	parentId := w.fs.driveId
+	if len(w.file.Parents) > 0 {
+		parentId = w.file.Parents[0]
+	}
+	var existing *drive.File
+	if w.file.Id != "" {
+		existing = w.file
+	}
+	_, err = replaceFile(w.fs.svc, parentId, w.file.Name, existing, w.tmp)
+	w.fs.forget()
+	return err
+}
+
+type fileInfo struct {
+	file *drive.File
+}
+
+func (fi *fileInfo) Name() string {
+	if fi.file.Name == "" {
+		return "/"
+	}
+	return fi.file.Name
+}
+
+func (fi *fileInfo) Size() int64 {
+	return fi.file.Size
+}
+
+func (fi *fileInfo) Mode() os.FileMode {
+	if fi.IsDir() {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+
+func (fi *fileInfo) ModTime() time.Time {
+	t, _ := time.Parse(time.RFC3339, fi.file.ModifiedTime)
+	return t
+}
+
+func (fi *fileInfo) IsDir() bool {
+	return isFolder(fi.file)
+}
+
+func (fi *fileInfo) Sys() interface{} {
+	return fi.file
+}
+
+func (fi *fileInfo) ContentType(ctx context.Context) (string, error) {
+	if fi.file.MimeType == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	return fi.file.MimeType, nil
+}
+
+func (fi *fileInfo) ETag(ctx context.Context) (string, error) {
+	if fi.file.Md5Checksum == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	return `"` + fi.file.Md5Checksum + `"`, nil
+}
+
+func formatOffset(off int64) string {
+	if off == 0 {
+		return ""
+	}
+	return strconv.FormatInt(off, 10) + "-"
+}
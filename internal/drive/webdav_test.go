@@ -0,0 +1,84 @@
+package drive
+
+import (
+	"context"
+	"google.golang.org/api/drive/v3"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestDavAuth(t *testing.T) {
+	var reached bool
+	a := &davAuth{
+		users: map[string]string{"farmer": "s3cret"},
+		next:  http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { reached = true }),
+	}
+	tests := []struct {
+		user, pass string
+		basic      bool
+		want       int
+	}{
+		{user: "farmer", pass: "s3cret", basic: true, want: http.StatusOK},
+		{user: "farmer", pass: "wrong", basic: true, want: http.StatusUnauthorized},
+		{user: "other", pass: "s3cret", basic: true, want: http.StatusUnauthorized},
+		{want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		reached = false
+		r := httptest.NewRequest("PROPFIND", "/", nil)
+		if tt.basic {
+			r.SetBasicAuth(tt.user, tt.pass)
+		}
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, r)
+		if w.Code != tt.want || reached != (tt.want == http.StatusOK) {
+			t.Errorf("%s:%s = %d reached %v, want %d", tt.user, tt.pass, w.Code, reached, tt.want)
+		}
+	}
+}
+
+func TestLoadUsers(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good")
+	ioutil.WriteFile(good, []byte("# farmers\nfarmer:s3:cret\n\nadmin:pw\n"), 0600)
+	users, err := loadUsers(good)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users["farmer"] != "s3:cret" || users["admin"] != "pw" {
+		t.Errorf("users = %v", users)
+	}
+	for _, content := range []string{"", "# nobody\n", "farmer\n", "farmer:\n", ":pw\n"} {
+		bad := filepath.Join(dir, "bad")
+		ioutil.WriteFile(bad, []byte(content), 0600)
+		if _, err = loadUsers(bad); err == nil {
+			t.Errorf("loadUsers(%q) accepted", content)
+		}
+	}
+}
+
+// An aborted or short PUT must fail before anything reaches the drive, fs has no service.
+func TestDavWriterIncomplete(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name string
+		ctx  context.Context
+	}{
+		{name: "aborted", ctx: canceled},
+		{name: "short", ctx: context.WithValue(context.Background(), contentLengthKey{}, int64(10))},
+	}
+	for _, tt := range tests {
+		w, err := newDavWriter(tt.ctx, &davFS{}, &drive.File{Id: "old", Name: "plot"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte("12345"))
+		if err = w.Close(); err == nil {
+			t.Errorf("%s: Close uploaded an incomplete file", tt.name)
+		}
+	}
+}
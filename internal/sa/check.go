@@ -0,0 +1,190 @@
+package sa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	statusValid    = "valid"
+	statusInvalid  = "invalid"
+	statusNoAccess = "no-access"
+	// statusError is a transient failure (quota, 5xx, network), the key is left in place
+	statusError = "error"
+)
+
+// Keys returns the key files in dir, sub directories (e.g. a quarantine folder) are skipped.
+func Keys(dir string) ([]string, error) {
+	fs, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, f := range fs {
+		if f.IsDir() {
+			continue
+		}
+		keys = append(keys, filepath.Join(dir, f.Name()))
+	}
+	return keys, nil
+}
+
+type keyCheck struct {
+	key    string
+	status string
+	err    error
+}
+
+// Check verifies every key in dir can get a token and list/create files in the drive.
+// Invalid and no-access keys are moved into quarantine when it is not empty, keys that
+// hit a transient error are only reported.
+func Check(dir string, driveId string, quarantine string, concurrency int) error {
+	keys, err := Keys(dir)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("cannot found sa file in %s", dir)
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	checks := make([]*keyCheck, len(keys))
+	idx := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range idx {
+				checks[i] = checkKey(keys[i], driveId)
+			}
+		}()
+	}
+	for i := range keys {
+		idx <- i
+	}
+	close(idx)
+	wg.Wait()
+
+	sort.Slice(checks, func(i, j int) bool { return checks[i].key < checks[j].key })
+	counts := make(map[string]int)
+	for i, c := range checks {
+		counts[c.status]++
+		if c.err != nil {
+			fmt.Printf("%d %s [%s] %v\n", i, c.key, c.status, c.err)
+		} else {
+			fmt.Printf("%d %s [%s]\n", i, c.key, c.status)
+		}
+		if c.status == statusValid || c.status == statusError || quarantine == "" {
+			continue
+		}
+		if err = os.MkdirAll(quarantine, 0700); err != nil {
+			return err
+		}
+		dst := filepath.Join(quarantine, filepath.Base(c.key))
+		if err = os.Rename(c.key, dst); err != nil {
+			fmt.Println("Quarantine error", c.key, err)
+		} else {
+			fmt.Println("Quarantine:", c.key, "->", dst)
+		}
+	}
+	fmt.Printf("valid: %d invalid: %d no-access: %d error: %d\n",
+		counts[statusValid], counts[statusInvalid], counts[statusNoAccess], counts[statusError])
+	return nil
+}
+
+func checkKey(key string, driveId string) *keyCheck {
+	c := &keyCheck{key: key, status: statusInvalid}
+	b, err := ioutil.ReadFile(key)
+	if err != nil {
+		c.err = err
+		return c
+	}
+	ctx := context.Background()
+	creds, err := google.CredentialsFromJSON(ctx, b, drive.DriveScope)
+	if err != nil {
+		c.err = err
+		return c
+	}
+	if _, err = creds.TokenSource.Token(); err != nil {
+		if !isRevoked(err) {
+			c.status = statusError
+		}
+		c.err = err
+		return c
+	}
+	svc, err := drive.NewService(ctx, option.WithTokenSource(creds.TokenSource))
+	if err != nil {
+		c.err = err
+		return c
+	}
+
+	c.status = statusNoAccess
+	// the capabilities tell write access without leaving probe files behind
+	d, err := svc.Drives.Get(driveId).Fields("capabilities(canAddChildren,canListChildren)").Do()
+	if err != nil {
+		if !isDenied(err) {
+			c.status = statusError
+		}
+		c.err = fmt.Errorf("get drive: %v", err)
+		return c
+	}
+	if d.Capabilities == nil || !d.Capabilities.CanListChildren {
+		c.err = fmt.Errorf("cannot list files")
+		return c
+	}
+	if !d.Capabilities.CanAddChildren {
+		c.err = fmt.Errorf("cannot create files")
+		return c
+	}
+	c.status = statusValid
+	return c
+}
+
+// isRevoked tells a disabled or deleted key from a token endpoint that is unavailable.
+func isRevoked(err error) bool {
+	var rerr *oauth2.RetrieveError
+	if !errors.As(err, &rerr) {
+		return false
+	}
+	switch rerr.Response.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+		return true
+	}
+	return strings.Contains(string(rerr.Body), "invalid_grant")
+}
+
+// isDenied reports the drive refused the key, rate limits also come as 403 and are not denials.
+func isDenied(err error) bool {
+	var gerr *googleapi.Error
+	if !errors.As(err, &gerr) {
+		return false
+	}
+	switch gerr.Code {
+	case http.StatusUnauthorized, http.StatusNotFound:
+		return true
+	case http.StatusForbidden:
+		for _, e := range gerr.Errors {
+			// rateLimitExceeded, userRateLimitExceeded
+			if strings.HasSuffix(strings.ToLower(e.Reason), "ratelimitexceeded") {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package sa
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iam/v1"
+	"google.golang.org/api/option"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+var service *iam.Service
+
+var accountIdPattern = regexp.MustCompile(`^[a-z][a-z0-9-]{4,28}[a-z0-9]$`)
+
+// InitService creates the iam service with the SA file, a custom endpoint (e.g. a local fake) can skip authentication.
+func InitService(saFile string, endpoint string, insecure bool) error {
+	opts := []option.ClientOption{option.WithScopes(iam.CloudPlatformScope)}
+	if insecure {
+		opts = append(opts, option.WithoutAuthentication())
+	} else {
+		opts = append(opts, option.WithCredentialsFile(saFile))
+	}
+	if endpoint != "" {
+		opts = append(opts, option.WithEndpoint(endpoint))
+	}
+	var err error
+	service, err = iam.NewService(context.Background(), opts...)
+	return err
+}
+
+// Create creates count service accounts named prefix-<n> in the project and writes a json key of each into dir.
+// Accounts that already exist are reused, a key is only generated when dir has none for the account.
+func Create(project string, prefix string, start int, count int, dir string) ([]string, error) {
+	for i := start; i < start+count; i++ {
+		if id := accountId(prefix, i); !accountIdPattern.MatchString(id) {
+			return nil, fmt.Errorf("invalid account id: %s, must be 6-30 lowercase letters, digits or hyphens", id)
+		}
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	var emails []string
+	for i := start; i < start+count; i++ {
+		id := accountId(prefix, i)
+		email := fmt.Sprintf("%s@%s.iam.gserviceaccount.com", id, project)
+		acc, err := service.Projects.ServiceAccounts.Create("projects/"+project, &iam.CreateServiceAccountRequest{
+			AccountId:      id,
+			ServiceAccount: &iam.ServiceAccount{DisplayName: id},
+		}).Do()
+		var gerr *googleapi.Error
+		if err == nil {
+			email = acc.Email
+			fmt.Printf("%d Create service account: %s [OK]\n", i, email)
+		} else if errors.As(err, &gerr) && gerr.Code == http.StatusConflict {
+			fmt.Printf("%d Service account exists: %s\n", i, email)
+		} else {
+			return emails, err
+		}
+		emails = append(emails, email)
+
+		keyFile := filepath.Join(dir, email+".json")
+		if _, err = os.Stat(keyFile); err == nil {
+			continue
+		}
+		key, err := createKey("projects/" + project + "/serviceAccounts/" + email)
+		if err != nil {
+			return emails, err
+		}
+		b, err := base64.StdEncoding.DecodeString(key.PrivateKeyData)
+		if err != nil {
+			return emails, err
+		}
+		if err = ioutil.WriteFile(keyFile, b, 0600); err != nil {
+			return emails, err
+		}
+		fmt.Printf("%d Create key: %s [OK]\n", i, keyFile)
+	}
+	return emails, nil
+}
+
+// keyRetries and keyBackoff bound the wait for a new account to become visible to the keys api.
+var (
+	keyRetries = 6
+	keyBackoff = time.Second
+)
+
+// createKey retries the 404 returned while a just created account is not yet propagated.
+func createKey(name string) (*iam.ServiceAccountKey, error) {
+	backoff := keyBackoff
+	for i := 0; ; i++ {
+		key, err := service.Projects.ServiceAccounts.Keys.Create(name, &iam.CreateServiceAccountKeyRequest{}).Do()
+		var gerr *googleapi.Error
+		if err == nil || i == keyRetries || !errors.As(err, &gerr) || gerr.Code != http.StatusNotFound {
+			return key, err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func accountId(prefix string, i int) string {
+	return fmt.Sprintf("%s-%d", prefix, i)
+}
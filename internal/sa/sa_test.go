@@ -0,0 +1,139 @@
+package sa
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeIAM serves the service account and key endpoints used by Create.
+type fakeIAM struct {
+	mu       sync.Mutex
+	accounts map[string]bool
+	// keyMisses is how many key requests of a new account answer 404, like a not yet propagated account
+	keyMisses int
+	misses    map[string]int
+	keys      int
+}
+
+func (f *fakeIAM) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/keys"):
+		parts := strings.Split(r.URL.Path, "/")
+		email := parts[len(parts)-2]
+		if f.misses[email] < f.keyMisses {
+			f.misses[email]++
+			writeError(w, http.StatusNotFound)
+			return
+		}
+		f.keys++
+		json.NewEncoder(w).Encode(map[string]string{
+			"privateKeyData": base64.StdEncoding.EncodeToString([]byte(`{"client_email":"` + email + `"}`)),
+		})
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/serviceAccounts"):
+		var req struct {
+			AccountId string `json:"accountId"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if f.accounts[req.AccountId] {
+			writeError(w, http.StatusConflict)
+			return
+		}
+		f.accounts[req.AccountId] = true
+		json.NewEncoder(w).Encode(map[string]string{"email": req.AccountId + "@p.iam.gserviceaccount.com"})
+	default:
+		writeError(w, http.StatusNotFound)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]interface{}{"code": code, "message": http.StatusText(code)}})
+}
+
+func startFake(t *testing.T, f *fakeIAM) {
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	if err := InitService("", srv.URL+"/", true); err != nil {
+		t.Fatal(err)
+	}
+	keyBackoff = time.Millisecond
+}
+
+func TestCreate(t *testing.T) {
+	tests := []struct {
+		name      string
+		existing  []string
+		keyFiles  []string
+		keyMisses int
+		wantKeys  int
+		wantErr   bool
+	}{
+		{name: "new accounts", wantKeys: 3},
+		{name: "existing account is reused", existing: []string{"upload-2"}, wantKeys: 3},
+		{name: "existing key file is kept", keyFiles: []string{"upload-1@p.iam.gserviceaccount.com.json"}, wantKeys: 2},
+		{name: "key retried until propagated", keyMisses: 2, wantKeys: 3},
+		{name: "key retries exhausted", keyMisses: 100, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeIAM{accounts: make(map[string]bool), misses: make(map[string]int), keyMisses: tt.keyMisses}
+			for _, id := range tt.existing {
+				f.accounts[id] = true
+			}
+			startFake(t, f)
+			dir := t.TempDir()
+			for _, name := range tt.keyFiles {
+				if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("{}"), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			emails, err := Create("p", "upload", 1, 3, dir)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(emails) != 3 {
+				t.Fatalf("emails = %v, want 3", emails)
+			}
+			if f.keys != tt.wantKeys {
+				t.Errorf("created %d keys, want %d", f.keys, tt.wantKeys)
+			}
+			for _, email := range emails {
+				b, err := ioutil.ReadFile(filepath.Join(dir, email+".json"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if fi, _ := os.Stat(filepath.Join(dir, email+".json")); fi.Mode().Perm() != 0600 {
+					t.Errorf("%s mode = %v, want 0600", email, fi.Mode().Perm())
+				}
+				if len(b) == 0 {
+					t.Errorf("%s key file is empty", email)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateInvalidPrefix(t *testing.T) {
+	if _, err := Create("p", "Bad_Prefix", 1, 1, t.TempDir()); err == nil {
+		t.Fatal("expected an invalid account id error")
+	}
+}
@@ -25,6 +25,9 @@ func main() {
 					admin.InitService(ts)
 				}
 			}
+			if dir := c.String("cache-dir"); dir != "" {
+				drive.InitCache(dir, c.Int64("cache-block")*1024, c.Int64("cache-size")*1024*1024)
+			}
 
 			return nil
 		},
@@ -38,8 +41,22 @@ func main() {
 				Aliases: []string{"s"},
 				Usage:   "user email to impersonate",
 			},
+			&cli.StringFlag{
+				Name:  "cache-dir",
+				Usage: "enable the local block cache for range reads",
+			},
+			&cli.Int64Flag{
+				Name:  "cache-size",
+				Usage: "block cache size limit (MiB)",
+				Value: 10240,
+			},
+			&cli.Int64Flag{
+				Name:  "cache-block",
+				Usage: "block cache block size (KiB)",
+				Value: 1024,
+			},
 		},
-		Commands: append(commands.Drive, commands.Group...),
+		Commands: concat(commands.Drive, commands.Group, commands.Serve, commands.SA, commands.Audit),
 	}
 
 	err := app.Run(os.Args)
@@ -48,3 +65,11 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+func concat(lists ...[]*cli.Command) []*cli.Command {
+	var cmds []*cli.Command
+	for _, l := range lists {
+		cmds = append(cmds, l...)
+	}
+	return cmds
+}